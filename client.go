@@ -2,15 +2,24 @@ package requester
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 )
 
 // ClientOptions is a callback signature for modifying client options.
 type Client struct {
 	*http.Client
-	url string
+	url       string
+	prefix    []string
+	limiters  map[string]*limiter
+	semaphore chan struct{}
+	onError   func(request *http.Request, response *http.Response, err error)
 }
 
 // ClientOptions is a callback signature for modifying client options.
@@ -43,6 +52,95 @@ func WithBaseURL(url string) ClientOptions {
 	}
 }
 
+// WithPerHostRateLimit limits the rate of outbound HTTP requests per host. The limits map a host,
+// as found in the request URL including any port, to the allowed number of requests per second.
+// Each host may burst up to the given number of requests. Hosts without a limit are not throttled.
+func WithPerHostRateLimit(limits map[string]float64, burst int) ClientOptions {
+	return func(client *Client) {
+		client.limiters = map[string]*limiter{}
+		for host, limit := range limits {
+			client.limiters[host] = newLimiter(limit, burst)
+		}
+	}
+}
+
+// WithMaxConcurrentRequests limits the number of concurrent in-flight HTTP requests sent by the client.
+// Requests exceeding the limit wait for a slot until their context is done.
+func WithMaxConcurrentRequests(n int) ClientOptions {
+	return func(client *Client) {
+		if n > 0 {
+			client.semaphore = make(chan struct{}, n)
+		}
+	}
+}
+
+// WithOnError registers a callback which is invoked when a request sent by the client fails after
+// all retries. The response of the last attempt is provided when available.
+func WithOnError(fn func(request *http.Request, response *http.Response, err error)) ClientOptions {
+	return func(client *Client) {
+		client.onError = fn
+	}
+}
+
+// WithDisableCompression disables the transparent gzip compression of the transport, so that
+// the response body is returned as encoded by the server along with its Content-Encoding header.
+func WithDisableCompression() ClientOptions {
+	return func(client *Client) {
+		withTransport(client, func(transport *http.Transport) {
+			transport.DisableCompression = true
+		})
+	}
+}
+
+// WithConnectTimeout sets the maximum amount of time a dial waits for a connection to complete,
+// independent of the overall timeout of the request.
+func WithConnectTimeout(duration time.Duration) ClientOptions {
+	return func(client *Client) {
+		withTransport(client, func(transport *http.Transport) {
+			transport.DialContext = (&net.Dialer{Timeout: duration, KeepAlive: 30 * time.Second}).DialContext
+		})
+	}
+}
+
+// WithIdleConnTimeout sets the maximum amount of time an idle connection remains open before closing itself.
+func WithIdleConnTimeout(duration time.Duration) ClientOptions {
+	return func(client *Client) {
+		withTransport(client, func(transport *http.Transport) {
+			transport.IdleConnTimeout = duration
+		})
+	}
+}
+
+// WithProxyBasicAuth routes all requests through the proxy at the given URL, authenticating
+// with basic HTTP authentication. An invalid proxy URL is reported when a request is sent.
+func WithProxyBasicAuth(proxyURL, username, password string) ClientOptions {
+	return func(client *Client) {
+		withTransport(client, func(transport *http.Transport) {
+			parsedURL, err := url.Parse(proxyURL)
+			if err != nil {
+				transport.Proxy = func(*http.Request) (*url.URL, error) {
+					return nil, err
+				}
+				return
+			}
+
+			parsedURL.User = url.UserPassword(username, password)
+			auth := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", username, password)))
+			transport.Proxy = http.ProxyURL(parsedURL)
+			transport.ProxyConnectHeader = http.Header{}
+			transport.ProxyConnectHeader.Set("Proxy-Authorization", fmt.Sprintf("Basic %s", auth))
+		})
+	}
+}
+
+// WithPrefix returns a copy of the client where the given prefix is prepended to the route
+// of all requests created by the copy. The original client is left unchanged.
+func (c *Client) WithPrefix(prefix string) *Client {
+	clone := *c
+	clone.prefix = append(append([]string{}, c.prefix...), prefix)
+	return &clone
+}
+
 // DELETE creates a HTTP DELETE request with the given route.
 func (c *Client) DELETE(ctx context.Context, route ...string) *Request {
 	return c.Request(ctx, http.MethodDelete, route...)
@@ -68,10 +166,26 @@ func (c *Client) PATCH(ctx context.Context, route ...string) *Request {
 	return c.Request(ctx, http.MethodPatch, route...)
 }
 
+// Method creates a HTTP request with the given HTTP method and route, e.g. for WebDAV methods like
+// PROPFIND or MKCOL. The method must be an uppercase token as defined in RFC 7230.
+func (c *Client) Method(ctx context.Context, method string, route ...string) *Request {
+	if err := validateMethod(method); err != nil {
+		return &Request{Client: c.Client, Error: err, client: c}
+	}
+
+	return c.Request(ctx, method, route...)
+}
+
 // Request creates a HTTP request with the given HTTP method and route.
 // If a base URL is specified in the client, the given route should just contain the path;
 // otherwise, provide the whole URL. The route segments will be joined with "/" as separator.
 func (c *Client) Request(ctx context.Context, method string, routes ...string) *Request {
+	if len(c.prefix) > 0 && c.url == "" && len(routes) > 0 {
+		routes = append(append([]string{routes[0]}, c.prefix...), routes[1:]...)
+	} else if len(c.prefix) > 0 {
+		routes = append(append([]string{}, c.prefix...), routes...)
+	}
+
 	uri, err := func() (string, error) {
 		if c.url == "" && len(routes) > 1 {
 			return url.JoinPath(routes[0], routes[1:]...)
@@ -87,5 +201,73 @@ func (c *Client) Request(ctx context.Context, method string, routes ...string) *
 		err = errors.Join(err, e)
 	}
 
-	return &Request{Request: request, Client: c.Client, Error: err}
+	return &Request{Request: request, Client: c.Client, Error: err, client: c}
+}
+
+// DoJSON sends a request with the given method and route using the client. Unless body is nil, it is
+// encoded as the JSON request body. Responses with a 2xx status code are decoded into dst, while other
+// responses are returned as a *StatusError. Methods can't have type parameters, so the client is passed
+// as an argument.
+func DoJSON[T any](ctx context.Context, client *Client, method, route string, body any, dst *T) error {
+	opts := []RequestOption{}
+	if body != nil {
+		opts = append(opts, WithRequestJSON(body))
+	}
+
+	response := client.Method(ctx, method, route).Do(opts...)
+	if response.Response == nil {
+		return response.Err
+	}
+
+	if response.Body != nil {
+		defer response.Body.Close()
+	}
+
+	err := response.Handle(WithResponseErrorMapper(func(status int, body []byte) error {
+		return &StatusError{Code: status, Body: body}
+	}))
+	if err != nil {
+		return err
+	}
+
+	return response.Handle(WithResponseJSON(dst))
+}
+
+// withTransport applies fn to a clone of the client transport, leaving the previous HTTP client
+// and transport untouched. Transports that aren't a *http.Transport are left unchanged.
+func withTransport(client *Client, fn func(transport *http.Transport)) {
+	roundTripper := client.Client.Transport
+	if roundTripper == nil {
+		roundTripper = http.DefaultTransport
+	}
+
+	transport, ok := roundTripper.(*http.Transport)
+	if !ok {
+		return
+	}
+
+	transport = transport.Clone()
+	fn(transport)
+
+	httpClient := *client.Client
+	httpClient.Transport = transport
+	client.Client = &httpClient
+}
+
+func validateMethod(method string) error {
+	if method == "" {
+		return errors.New("invalid HTTP method: method is empty")
+	}
+
+	for _, char := range method {
+		switch {
+		case 'A' <= char && char <= 'Z', '0' <= char && char <= '9', strings.ContainsRune("!#$%&'*+-.^_`|~", char):
+		case 'a' <= char && char <= 'z':
+			return fmt.Errorf("invalid HTTP method '%s': method must be uppercase", method)
+		default:
+			return fmt.Errorf("invalid HTTP method '%s': invalid character %q", method, char)
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,59 @@
+package requester
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// limiter is a token bucket allowing rate events per second with bursts of up to burst events.
+type limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(rate float64, burst int) *limiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &limiter{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// wait blocks until an event is allowed or the context is done.
+func (l *limiter) wait(ctx context.Context) error {
+	if l.rate <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if !l.last.IsZero() {
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+
+	l.last = now
+	l.tokens--
+	delay := time.Duration(0)
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
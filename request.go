@@ -1,7 +1,9 @@
 package requester
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/base64"
 	"encoding/json"
@@ -9,11 +11,21 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/rand"
+	"mime"
 	"mime/multipart"
 	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
 	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -28,8 +40,50 @@ const (
 	// FallbackPolicyExponential waits for issuing a new request by
 	// given attempt multiplied with itself and attempt.
 	FallbackPolicyExponential
+	// FallbackPolicyDecorrelatedJitter waits for issuing a new request by a random
+	// duration between the given duration and three times the previous wait,
+	// capped by MaxBackoff.
+	FallbackPolicyDecorrelatedJitter
+	// FallbackPolicyExponentialJitter waits for issuing a new request by a random
+	// duration using full jitter: a uniformly distributed duration in the interval
+	// [0, duration * attempt * attempt].
+	FallbackPolicyExponentialJitter
 )
 
+// maxDrainBytes is the number of body bytes read from a retried response, so its connection can be reused.
+const maxDrainBytes = 64 << 10
+
+// ErrFirstByteTimeout is returned when the first byte of the response isn't received
+// within the duration given to WithRequestTTFBTimeout.
+var ErrFirstByteTimeout = errors.New("timed out waiting for the first response byte")
+
+// BodyEncoder transforms the buffered request body, optionally setting headers
+// describing the encoding.
+type BodyEncoder func(body []byte, header http.Header) ([]byte, error)
+
+// BodyEncoderGzip compresses the body with gzip and adds gzip to the Content-Encoding header.
+func BodyEncoderGzip(body []byte, header http.Header) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	writer := gzip.NewWriter(buffer)
+	if _, err := writer.Write(body); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	header.Add("Content-Encoding", "gzip")
+	return buffer.Bytes(), nil
+}
+
+// BodyEncoderBase64 encodes the body with standard base64 encoding and sets the
+// Content-Transfer-Encoding header.
+func BodyEncoderBase64(body []byte, header http.Header) ([]byte, error) {
+	header.Set("Content-Transfer-Encoding", "base64")
+	return []byte(base64.StdEncoding.EncodeToString(body)), nil
+}
+
 // RequestOption callback signature for modifying request
 type RequestOption func(request *Request) (err error)
 
@@ -56,19 +110,44 @@ type Request struct {
 	// FallbackStatusCodes contains a list of HTTP status codes that will
 	// trigger a new request.
 	FallbackStatusCodes []int
+
+	// Timeout specifies the time limit for the request including retries. If the request
+	// context has an earlier deadline, the context deadline takes precedence.
+	Timeout time.Duration
+
+	// MaxBackoff caps the duration to wait before attempting the request again, for all
+	// fallback policies and Retry-After headers. Zero means unbounded.
+	MaxBackoff time.Duration
+
+	client             *Client
+	previousBackoff    time.Duration
+	maxURLLength       int
+	firstByteTimeout   time.Duration
+	beforeAttempt      []func(request *http.Request, attempt int) error
+	strict             bool
+	bodies             int
+	retryExcludeStatus []int
+	timeoutRetryReset  bool
+	ignoreRetryAfter   bool
+	random             *rand.Rand
+	expectGzip         bool
+	consume            func(response *http.Response) error
+	consumeFailed      bool
+	liftTimeout        func()
 }
 
 // Dry performs a dry run of the request without actually executing it.
-func (r *Request) Dry(opts ...RequestOption) (err error) {
+func (r *Request) Dry(opts ...RequestOption) error {
 	if r.Error != nil {
 		return r.Error
 	}
 
+	errs := []error{}
 	for _, o := range opts {
-		err = errors.Join(r.Error, o(r))
+		errs = append(errs, o(r))
 	}
 
-	return err
+	return errors.Join(append(errs, r.validate())...)
 }
 
 // Do executes the request.
@@ -82,49 +161,505 @@ func (r *Request) Do(opts ...RequestOption) *Response {
 		errs = append(errs, o(r))
 	}
 
+	if err := r.validate(); err != nil {
+		return &Response{Response: &http.Response{}, Err: errors.Join(append(errs, err)...)}
+	}
+
+	cancel := context.CancelFunc(func() {})
+	if r.Timeout > 0 && !r.timeoutRetryReset {
+		parent := r.Context()
+		var ctx *timeoutContext
+		ctx, cancel = withTimeout(parent, r.Timeout)
+		r.liftTimeout = ctx.lift
+		r.Request = r.Request.WithContext(ctx)
+		defer func() { r.Request = r.Request.WithContext(parent) }()
+	}
+
+	r.consumeFailed = false
+	start := time.Now()
 	response, err := r.sender(0, nil, []error{})
+	duration := time.Since(start)
 	errs = append(errs, err...)
 
-	return &Response{response, errors.Join(errs...)}
+	encoding := strings.Join((&Response{Response: response}).HeaderValues("Content-Encoding"), ", ")
+	if r.expectGzip && response != nil && response.ContentLength != 0 && !strings.EqualFold(encoding, "gzip") {
+		errs = append(errs, fmt.Errorf("expected gzip-encoded response, received Content-Encoding '%s'", encoding))
+	}
+
+	failed := len(err) > 0 && (response == nil || r.retryable(response.StatusCode) || r.consumeFailed)
+	if failed && r.client != nil && r.client.onError != nil {
+		r.client.onError(r.Request, response, errors.Join(err...))
+	}
+
+	if response != nil && response.Body != nil {
+		response.Body = &cancelReadCloser{ReadCloser: response.Body, cancel: cancel}
+	} else {
+		cancel()
+	}
+
+	liftTimeout := r.liftTimeout
+	r.liftTimeout = nil
+	return &Response{Response: response, Err: errors.Join(errs...), Duration: duration, liftTimeout: liftTimeout}
+}
+
+// setBody sets the byte slice as a reusable request body.
+func (r *Request) setBody(body []byte) {
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+}
+
+// CapturedBody returns the content of the request body without consuming it, so it can be called
+// repeatedly and the request can still be sent. Bodies which can't be rewound are buffered.
+func (r *Request) CapturedBody() ([]byte, error) {
+	if r.Request == nil || r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+
+	if r.GetBody != nil {
+		body, err := r.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+
+		return io.ReadAll(body)
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	r.setBody(body)
+	return body, nil
+}
+
+// validate checks the request against the constraints set by the request options.
+func (r *Request) validate() error {
+	if r.strict && r.bodies > 1 {
+		return fmt.Errorf("strict mode: request body was set %d times", r.bodies)
+	}
+
+	if r.strict && len(r.Header.Values("Content-Type")) > 1 {
+		return fmt.Errorf("strict mode: Content-Type was set %d times", len(r.Header.Values("Content-Type")))
+	}
+
+	if length := len(r.URL.String()); r.maxURLLength > 0 && length > r.maxURLLength {
+		return fmt.Errorf("URL length %d exceeds the maximum of %d, consider sending the parameters in the body", length, r.maxURLLength)
+	}
+
+	return nil
+}
+
+// Repeat sends the request n times with at most concurrency requests in flight, and returns the
+// responses in the order they were issued. Each send uses a copy of the request with a fresh body.
+// Requests with a body which can't be rewound can't be repeated, so each response holds an error.
+func (r *Request) Repeat(n int, concurrency int) []*Response {
+	if n <= 0 {
+		return nil
+	}
+
+	responses := make([]*Response, n)
+	if r.Error == nil && r.Request != nil && r.GetBody == nil && r.Body != nil && r.Body != http.NoBody && n > 1 {
+		for i := range responses {
+			responses[i] = &Response{Response: &http.Response{}, Err: errors.New("request body can't be rewound to be repeated")}
+		}
+
+		return responses
+	}
+
+	semaphore := make(chan struct{}, max(concurrency, 1))
+	wg := sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		clone := r.clone()
+		go func(i int) {
+			defer func() { <-semaphore; wg.Done() }()
+			responses[i] = clone.Do()
+		}(i)
+	}
+
+	wg.Wait()
+	return responses
+}
+
+// clone returns a copy of the request which can be sent independently of the original. The copy
+// has its own body, rewound through GetBody, and its own random source.
+func (r *Request) clone() *Request {
+	clone := *r
+	if r.Request != nil {
+		clone.Request = r.Request.Clone(r.Context())
+		if r.GetBody != nil && r.Body != nil && r.Body != http.NoBody {
+			body, err := r.GetBody()
+			if err != nil {
+				clone.Error = errors.Join(clone.Error, err)
+			}
+
+			clone.Body = body
+		}
+	}
+
+	if r.random != nil {
+		clone.random = rand.New(rand.NewSource(r.random.Int63()))
+	}
+
+	return &clone
+}
+
+// Download sends the request and writes the response body to the file at the given path. If the
+// transfer fails, the request is retried according to the retry policy with a Range header, so the
+// download resumes from the size of the partially written file. The request is sent like Do, so the
+// timeout, hooks and retry settings of the request apply.
+func (r *Request) Download(filePath string) error {
+	if r.Error != nil || r.Request == nil {
+		return r.Error
+	}
+
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var attempt int
+	var offset int64
+	hooks := r.beforeAttempt
+	ranges := slices.Clone(r.Header.Values("Range"))
+	restoreRange := func(header http.Header) {
+		if header.Del("Range"); len(ranges) > 0 {
+			header["Range"] = slices.Clone(ranges)
+		}
+	}
+
+	r.beforeAttempt = append(slices.Clone(hooks), func(request *http.Request, n int) (err error) {
+		attempt = n
+		if offset, err = file.Seek(0, io.SeekEnd); err != nil {
+			return err
+		}
+
+		if offset > 0 {
+			request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		} else {
+			restoreRange(request.Header)
+		}
+
+		return nil
+	})
+
+	downloaded := false
+	r.consume = func(response *http.Response) (err error) {
+		defer response.Body.Close()
+		if response.StatusCode != http.StatusPartialContent || offset == 0 {
+			if err = file.Truncate(0); err == nil {
+				_, err = file.Seek(0, io.SeekStart)
+			}
+		}
+
+		if err == nil {
+			_, err = io.Copy(file, response.Body)
+		}
+
+		downloaded = err == nil
+		return err
+	}
+
+	defer func() {
+		r.beforeAttempt = hooks
+		r.consume = nil
+		restoreRange(r.Header)
+	}()
+
+	response := r.Do()
+	if response.Response != nil && response.Body != nil {
+		response.Body.Close()
+	}
+
+	switch {
+	case downloaded:
+		return nil
+	case response.Err != nil:
+		return response.Err
+	default:
+		return fmt.Errorf("received HTTP status code %d in attempt %d", response.StatusCode, attempt)
+	}
+}
+
+// Curl renders the request as an equivalent curl command. Call it after the request options
+// have been applied, e.g. with Dry. The Authorization headers are redacted. The body is only
+// rendered if it can be rewound through GetBody, so the request is never consumed.
+func (r *Request) Curl() string {
+	return r.curl(true)
+}
+
+// CurlUnredacted renders the request as an equivalent curl command including the
+// Authorization headers.
+func (r *Request) CurlUnredacted() string {
+	return r.curl(false)
+}
+
+func (r *Request) curl(redact bool) string {
+	if r.Request == nil {
+		return ""
+	}
+
+	quote := func(value string) string {
+		return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+	}
+
+	command := []string{"curl", "-X", r.Method, quote(r.URL.String())}
+
+	keys := make([]string, 0, len(r.Header))
+	for key := range r.Header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		for _, value := range r.Header[key] {
+			if redact && (key == "Authorization" || key == "Proxy-Authorization") {
+				value = "REDACTED"
+			}
+
+			command = append(command, "-H", quote(fmt.Sprintf("%s: %s", key, value)))
+		}
+	}
+
+	if r.GetBody != nil && r.Body != nil && r.Body != http.NoBody {
+		if body, err := r.GetBody(); err == nil {
+			data, err := io.ReadAll(body)
+			body.Close()
+			if err == nil && len(data) > 0 {
+				command = append(command, "--data", quote(string(data)))
+			}
+		}
+	}
+
+	return strings.Join(command, " ")
 }
 
 func (r *Request) sender(attempt int, response *http.Response, errs []error) (*http.Response, []error) {
 	if 0 < attempt {
-		if attempt >= r.Retries {
+		if attempt >= r.Retries || r.Context().Err() != nil {
 			return response, errs
 		}
 
-		switch r.FallbackPolicy {
-		case FallbackPolicyExponential:
-			r.wait(r.FallbackDuration * (time.Duration(attempt * attempt)))
-		default:
-			r.wait(r.FallbackDuration * time.Duration(attempt))
+		delay := r.backoff(attempt)
+		if retryAfter, ok := r.retryAfter(response); ok {
+			delay = retryAfter
+		}
+
+		if r.MaxBackoff > 0 {
+			delay = min(delay, r.MaxBackoff)
+		}
+
+		if response != nil && response.Body != nil {
+			io.Copy(io.Discard, io.LimitReader(response.Body, maxDrainBytes))
+			response.Body.Close()
+		}
+
+		if r.wait(delay) {
+			return response, append(errs, r.Context().Err())
 		}
 	}
 
 	attempt++
-	response, err := r.Client.Do(r.Request)
+	if r.GetBody != nil && r.Body != nil {
+		body, err := r.GetBody()
+		if err != nil {
+			return response, append(errs, err)
+		}
+
+		r.Body.Close()
+		r.Body = body
+	}
+
+	for _, fn := range r.beforeAttempt {
+		if err := fn(r.Request, attempt); err != nil {
+			return response, append(errs, err)
+		}
+	}
+
+	response, err := r.attempt()
 	if err != nil {
 		return r.sender(attempt, response, append(errs, err))
 	}
 
-	for _, statusCode := range r.FallbackStatusCodes {
-		if statusCode == response.StatusCode {
-			return r.sender(attempt, response, append(errs, fmt.Errorf("received HTTP status code %d in attempt %d", statusCode, attempt)))
+	if r.retryable(response.StatusCode) {
+		return r.sender(attempt, response, append(errs, fmt.Errorf("received HTTP status code %d in attempt %d", response.StatusCode, attempt)))
+	}
+
+	if r.consume != nil && response.StatusCode >= 200 && response.StatusCode <= 299 {
+		err := r.consume(response)
+		r.consumeFailed = err != nil
+		if err != nil {
+			return r.sender(attempt, response, append(errs, err))
 		}
 	}
 
 	return response, errs
 }
 
-func (r *Request) wait(duration time.Duration) {
-	if duration == 0 {
-		return
+// retryAfter returns the duration requested by the Retry-After header of a retryable response, given either
+// in seconds or as an HTTP-date. It returns false if the header is absent, unparseable or ignored.
+func (r *Request) retryAfter(response *http.Response) (time.Duration, bool) {
+	if r.ignoreRetryAfter || response == nil || !r.retryable(response.StatusCode) {
+		return 0, false
+	}
+
+	values := (&Response{Response: response}).HeaderValues("Retry-After")
+	if len(values) == 0 || values[0] == "" {
+		return 0, false
+	}
+
+	value := values[0]
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+
+	return 0, false
+}
+
+// retryable reports whether a response with the given status code triggers a new attempt.
+func (r *Request) retryable(statusCode int) bool {
+	return slices.Contains(r.FallbackStatusCodes, statusCode) && !slices.Contains(r.retryExcludeStatus, statusCode)
+}
+
+// attempt sends the request once. If the timeout is reset per attempt, the attempt is sent with a fresh
+// timeout derived from the request context, which lasts until the response body is closed.
+func (r *Request) attempt() (*http.Response, error) {
+	if !r.timeoutRetryReset || r.Timeout <= 0 {
+		return r.send()
+	}
+
+	parent := r.Context()
+	ctx, cancel := withTimeout(parent, r.Timeout)
+	r.liftTimeout = ctx.lift
+	r.Request = r.Request.WithContext(ctx)
+	defer func() { r.Request = r.Request.WithContext(parent) }()
+
+	response, err := r.send()
+	if response != nil && response.Body != nil {
+		response.Body = &cancelReadCloser{ReadCloser: response.Body, cancel: cancel}
+	} else {
+		cancel()
+	}
+
+	return response, err
+}
+
+// send performs a single attempt, honoring the rate and concurrency limits of the client.
+func (r *Request) send() (*http.Response, error) {
+	if r.client != nil {
+		if l, ok := r.client.limiters[r.URL.Host]; ok {
+			if err := l.wait(r.Context()); err != nil {
+				return nil, err
+			}
+		}
+
+		if r.client.semaphore != nil {
+			select {
+			case r.client.semaphore <- struct{}{}:
+				defer func() { <-r.client.semaphore }()
+			case <-r.Context().Done():
+				return nil, r.Context().Err()
+			}
+		}
+	}
+
+	return r.do()
+}
+
+// do sends the HTTP request, cancelling it if the first response byte isn't received in time.
+func (r *Request) do() (*http.Response, error) {
+	if r.firstByteTimeout <= 0 {
+		return r.Client.Do(r.Request)
+	}
+
+	ctx, cancel := context.WithCancelCause(r.Context())
+	timer := time.AfterFunc(r.firstByteTimeout, func() { cancel(ErrFirstByteTimeout) })
+	defer timer.Stop()
+
+	trace := &httptrace.ClientTrace{GotFirstResponseByte: func() { timer.Stop() }}
+	response, err := r.Client.Do(r.Request.WithContext(httptrace.WithClientTrace(ctx, trace)))
+	if err != nil {
+		if errors.Is(context.Cause(ctx), ErrFirstByteTimeout) {
+			err = fmt.Errorf("%w after %s: %w", ErrFirstByteTimeout, r.firstByteTimeout, err)
+		}
+
+		cancel(nil)
+		return response, err
+	}
+
+	response.Body = &cancelReadCloser{ReadCloser: response.Body, cancel: func() { cancel(nil) }}
+	return response, nil
+}
+
+// int63n returns a random number in the interval [0, n) from the random source of the request,
+// or from the global source if the request has none.
+func (r *Request) int63n(n int64) int64 {
+	if r.random != nil {
+		return r.random.Int63n(n)
 	}
 
-	ctx, ctxFunc := context.WithTimeout(r.Context(), duration)
-	defer ctxFunc()
-	<-ctx.Done()
+	return rand.Int63n(n)
+}
+
+func (r *Request) backoff(attempt int) time.Duration {
+	switch r.FallbackPolicy {
+	case FallbackPolicyExponential:
+		return r.FallbackDuration * (time.Duration(attempt * attempt))
+	case FallbackPolicyExponentialJitter:
+		if ceiling := r.FallbackDuration * time.Duration(attempt*attempt); ceiling > 0 {
+			return time.Duration(r.int63n(int64(ceiling) + 1))
+		}
+
+		return 0
+	case FallbackPolicyDecorrelatedJitter:
+		previous := r.previousBackoff
+		if attempt == 1 || previous < r.FallbackDuration {
+			previous = r.FallbackDuration
+		}
+
+		duration := r.FallbackDuration
+		if spread := previous*3 - r.FallbackDuration; spread > 0 {
+			duration += time.Duration(r.int63n(int64(spread) + 1))
+		}
+
+		if r.MaxBackoff > 0 && duration > r.MaxBackoff {
+			duration = r.MaxBackoff
+		}
+
+		r.previousBackoff = duration
+		return duration
+	default:
+		return r.FallbackDuration * time.Duration(attempt)
+	}
+}
+
+// wait blocks for the given duration and reports whether it was cancelled by the request context.
+func (r *Request) wait(duration time.Duration) (cancelled bool) {
+	if duration <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return false
+	case <-r.Context().Done():
+		return true
+	}
 }
 
 // WithRequestRetryPolicy sets the retry policy for the request.
@@ -141,85 +676,432 @@ func WithRequestRetryPolicy(retries int, duration time.Duration, policy Fallback
 		request.FallbackPolicy = policy
 		request.FallbackStatusCodes = statuscodes
 
-		return nil
+		return nil
+	}
+}
+
+// WithRequestRetryMaxBackoff caps the duration to wait before attempting the request again. Zero means unbounded.
+func WithRequestRetryMaxBackoff(maxBackoff time.Duration) RequestOption {
+	return func(request *Request) (err error) {
+		request.MaxBackoff = maxBackoff
+		return nil
+	}
+}
+
+// WithRequestRetryRespectRetryAfter sets whether the Retry-After header of a retryable response is honored.
+// When honored, which is the default, the request waits for the duration given by the header, in seconds
+// or as an HTTP-date, instead of the duration of the retry policy. Absent or unparseable headers fall
+// back to the retry policy.
+func WithRequestRetryRespectRetryAfter(respect bool) RequestOption {
+	return func(request *Request) (err error) {
+		request.ignoreRetryAfter = !respect
+		return nil
+	}
+}
+
+// WithRequestBeforeAttempt registers a hook which is invoked before each attempt of sending the
+// request, e.g. to refresh signatures or timestamps in the headers. The attempt starts at 1.
+// If the hook returns an error, the request isn't sent.
+func WithRequestBeforeAttempt(fn func(request *http.Request, attempt int) error) RequestOption {
+	return func(request *Request) (err error) {
+		request.beforeAttempt = append(request.beforeAttempt, fn)
+		return nil
+	}
+}
+
+// WithRequestRetryExcludeStatus excludes the given status codes from triggering a new attempt,
+// even if they're part of the status codes of the retry policy.
+func WithRequestRetryExcludeStatus(statuscodes ...int) RequestOption {
+	return func(request *Request) (err error) {
+		request.retryExcludeStatus = append(request.retryExcludeStatus, statuscodes...)
+		return nil
+	}
+}
+
+// WithRequestTimeout sets the timeout duration for the request. The timeout covers all attempts,
+// unless WithRequestTimeoutRetryReset is given, and reading the response body. If the request context
+// has an earlier deadline, it takes precedence.
+func WithRequestTimeout(duration time.Duration) RequestOption {
+	return func(request *Request) (err error) {
+		request.Timeout = duration
+		return nil
+	}
+}
+
+// WithRequestTimeoutRetryReset applies the timeout of WithRequestTimeout to each attempt instead of to
+// all attempts, so every retry gets the full timeout. The request context deadline still applies to
+// all attempts.
+func WithRequestTimeoutRetryReset() RequestOption {
+	return func(request *Request) (err error) {
+		request.timeoutRetryReset = true
+		return nil
+	}
+}
+
+// WithRequestTTFBTimeout cancels an attempt if the first byte of the response isn't
+// received within the given duration, independent of the overall request timeout.
+func WithRequestTTFBTimeout(duration time.Duration) RequestOption {
+	return func(request *Request) (err error) {
+		request.firstByteTimeout = duration
+		return nil
+	}
+}
+
+// WithRequestMaxRedirects follows at most n redirects for the request, leaving the redirect policy of the
+// client unchanged. When the limit is reached, the last redirect response is returned without an error.
+func WithRequestMaxRedirects(n int) RequestOption {
+	return func(request *Request) (err error) {
+		client := *request.Client
+		client.CheckRedirect = func(_ *http.Request, via []*http.Request) error {
+			if len(via) > n {
+				return http.ErrUseLastResponse
+			}
+
+			return nil
+		}
+
+		request.Client = &client
+		return nil
+	}
+}
+
+// WithRequestTransport sends the request with the given transport, leaving the transport of the client unchanged.
+func WithRequestTransport(transport http.RoundTripper) RequestOption {
+	return func(request *Request) (err error) {
+		client := *request.Client
+		client.Transport = transport
+		request.Client = &client
+		return nil
+	}
+}
+
+// WithRequestOn1xx invokes fn for each informational 1xx response received before the final
+// response, e.g. 103 Early Hints carrying preload links.
+func WithRequestOn1xx(fn func(code int, header http.Header)) RequestOption {
+	return func(request *Request) (err error) {
+		trace := &httptrace.ClientTrace{
+			Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+				fn(code, http.Header(header))
+				return nil
+			},
+		}
+
+		request.Request = request.WithContext(httptrace.WithClientTrace(request.Context(), trace))
+		return nil
+	}
+}
+
+// WithRequestOptions composes multiple request options.
+func WithRequestOptions(opts ...RequestOption) RequestOption {
+	return func(request *Request) (err error) {
+		for _, opt := range opts {
+			err = errors.Join(err, opt(request))
+		}
+
+		return err
+	}
+}
+
+// WithRequestURL sets the URL for the request. The URL fully replaces the URL of the request,
+// including the base URL of the client.
+func WithRequestURL(rawUrl string) RequestOption {
+	return func(request *Request) (err error) {
+		parsedUrl, err := url.Parse(rawUrl)
+		if err != nil {
+			return err
+		}
+
+		request.URL = parsedUrl
+		request.Host = parsedUrl.Host
+		return nil
+	}
+}
+
+// WithRequestRelativeURL sets the URL for the request to the given path, including any query, joined
+// with the base URL and prefix of the client.
+func WithRequestRelativeURL(path string) RequestOption {
+	return func(request *Request) (err error) {
+		if request.client == nil || request.client.url == "" {
+			return errors.New("relative URL requires a client with a base URL")
+		}
+
+		base, err := url.Parse(request.client.url)
+		if err != nil {
+			return err
+		}
+
+		reference, err := url.Parse(path)
+		if err != nil {
+			return err
+		}
+
+		if reference.IsAbs() {
+			return fmt.Errorf("expected a relative URL, received '%s'", path)
+		}
+
+		joined := base.JoinPath(append(slices.Clone(request.client.prefix), reference.Path)...)
+		joined.RawQuery = reference.RawQuery
+		request.URL = joined
+		request.Host = joined.Host
+		return nil
+	}
+}
+
+// WithRequestStrict fails the request if the body or the Content-Type header is set more than once
+// by the request options, which usually indicates a bug in the composition of options.
+func WithRequestStrict() RequestOption {
+	return func(request *Request) error {
+		request.strict = true
+		return nil
+	}
+}
+
+// WithRequestMaxURLLength fails the request if the length of the URL exceeds max after all
+// request options have been applied.
+func WithRequestMaxURLLength(max int) RequestOption {
+	return func(request *Request) error {
+		request.maxURLLength = max
+		return nil
+	}
+}
+
+// WithRequestURLQuery sets the URL query parameters for the request.
+func WithRequestURLQuery(query map[string][]any) RequestOption {
+	return func(request *Request) error {
+		url := request.URL.Query()
+		for key, values := range query {
+			for _, value := range values {
+				url.Add(key, fmt.Sprint(value))
+			}
+		}
+
+		request.URL.RawQuery = url.Encode()
+		return nil
+	}
+}
+
+// WithRequestQueryBracketed sets the URL query parameters for the request, appending "[]" to the keys
+// with multiple values, as expected by PHP and Rails backends, e.g. "tags[]=a&tags[]=b".
+func WithRequestQueryBracketed(query map[string][]any) RequestOption {
+	return func(request *Request) error {
+		url := request.URL.Query()
+		for key, values := range query {
+			if len(values) > 1 {
+				key += "[]"
+			}
+
+			for _, value := range values {
+				url.Add(key, fmt.Sprint(value))
+			}
+		}
+
+		request.URL.RawQuery = url.Encode()
+		return nil
+	}
+}
+
+// WithRequestDedupeQuery removes duplicate key and value pairs from the URL query parameters,
+// preserving distinct values of the same key.
+func WithRequestDedupeQuery() RequestOption {
+	return func(request *Request) error {
+		query := request.URL.Query()
+		for key, values := range query {
+			unique := []string{}
+			for _, value := range values {
+				if !slices.Contains(unique, value) {
+					unique = append(unique, value)
+				}
+			}
+
+			query[key] = unique
+		}
+
+		request.URL.RawQuery = query.Encode()
+		return nil
+	}
+}
+
+// WithRequestBody sets the request body. The body is buffered, so the request can be
+// sent multiple times with the same body.
+func WithRequestBody(body io.Reader) RequestOption {
+	return func(request *Request) error {
+		buffer := &bytes.Buffer{}
+		if _, err := io.Copy(buffer, body); err != nil {
+			return err
+		}
+
+		return WithRequestBodyBytes(buffer.Bytes())(request)
 	}
 }
 
-// WithRequestTimeout sets the timeout duration for the request.
-func WithRequestTimeout(duration time.Duration) RequestOption {
-	return func(request *Request) (err error) {
-		request.Timeout = duration
+// WithRequestBodyBytes sets the byte slice as the request body. Byte slice bodies are
+// reusable, so the request can be sent multiple times with the same body.
+func WithRequestBodyBytes(body []byte) RequestOption {
+	return func(request *Request) error {
+		request.setBody(body)
+		request.bodies++
 		return nil
 	}
 }
 
-// WithRequestOptions composes multiple request options.
-func WithRequestOptions(opts ...RequestOption) RequestOption {
-	return func(request *Request) (err error) {
-		for _, opt := range opts {
-			err = errors.Join(err, opt(request))
-		}
+// WithRequestBodyLimited streams at most limit bytes from the reader as the request body and sets
+// the Content-Length to limit. Sending fails if the reader holds fewer than limit bytes. The body
+// isn't buffered, so the request can't be retried.
+func WithRequestBodyLimited(body io.Reader, limit int64) RequestOption {
+	return func(request *Request) error {
+		request.Body = io.NopCloser(&exactReader{reader: io.LimitReader(body, limit), remaining: limit})
+		request.ContentLength = limit
+		request.GetBody = nil
+		request.bodies++
+		return nil
+	}
+}
 
-		return err
+// WithRequestBodyProgress streams the reader as the request body and calls onProgress with the number
+// of bytes sent so far and the total as the body is read by the transport. The total is used as the
+// Content-Length of the request. The body can only be read once and is incompatible with retries.
+func WithRequestBodyProgress(r io.Reader, total int64, onProgress func(sent, total int64)) RequestOption {
+	return func(request *Request) error {
+		request.Body = io.NopCloser(&progressReader{reader: r, total: total, onProgress: onProgress})
+		request.ContentLength = total
+		request.GetBody = nil
+		request.bodies++
+		return nil
 	}
 }
 
-// WithRequestURL sets the URL for the request.
-func WithRequestURL(rawUrl string) RequestOption {
-	return func(request *Request) (err error) {
-		parsedUrl, err := url.Parse(rawUrl)
+// WithRequestBodyFile sets the content of the file as the raw request body.
+// The Content-Type is derived from the file extension, or sniffed from the content when the
+// extension is unknown. The file is reopened whenever the body has to be sent again.
+func WithRequestBodyFile(filePath string) RequestOption {
+	return func(request *Request) error {
+		file, err := os.Open(filePath)
 		if err != nil {
 			return err
 		}
 
-		request.URL = parsedUrl
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return err
+		}
+
+		contentType := mime.TypeByExtension(filepath.Ext(filePath))
+		if contentType == "" {
+			sniff := make([]byte, 512)
+			n, err := io.ReadFull(file, sniff)
+			if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+				file.Close()
+				return err
+			}
+
+			if _, err = file.Seek(0, io.SeekStart); err != nil {
+				file.Close()
+				return err
+			}
+
+			contentType = http.DetectContentType(sniff[:n])
+		}
+
+		request.Body = file
+		request.bodies++
+		request.ContentLength = info.Size()
+		request.GetBody = func() (io.ReadCloser, error) {
+			return os.Open(filePath)
+		}
+
+		request.Header.Set("Content-Type", contentType)
 		return nil
 	}
 }
 
-// WithRequestURLQuery sets the URL query parameters for the request.
-func WithRequestURLQuery(query map[string][]any) RequestOption {
+// WithRequestAutoDetectContentType sets the Content-Type header based on the content of the body
+// when it isn't already present. It must be provided after the option setting the body. A body
+// which can't be rewound through GetBody is detected from its first 512 bytes without consuming it.
+func WithRequestAutoDetectContentType() RequestOption {
 	return func(request *Request) error {
-		url := request.URL.Query()
-		for key, values := range query {
-			for _, value := range values {
-				url.Add(key, fmt.Sprint(value))
+		if request.Header.Get("Content-Type") != "" || request.Body == nil || request.Body == http.NoBody {
+			return nil
+		}
+
+		var content []byte
+		if request.GetBody != nil {
+			body, err := request.GetBody()
+			if err != nil {
+				return err
+			}
+			defer body.Close()
+
+			if content, err = io.ReadAll(body); err != nil {
+				return err
+			}
+		} else {
+			reader := bufio.NewReaderSize(request.Body, 512)
+			peeked, err := reader.Peek(512)
+			if err != nil && err != io.EOF {
+				return err
 			}
+
+			content = peeked
+			request.Body = struct {
+				io.Reader
+				io.Closer
+			}{reader, request.Body}
 		}
 
-		request.URL.RawQuery = url.Encode()
+		contentType := http.DetectContentType(content)
+		if trimmed := bytes.TrimSpace(content); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed) {
+			contentType = "application/json"
+		}
+
+		request.Header.Set("Content-Type", contentType)
 		return nil
 	}
 }
 
-// WithRequestBody sets the request body.
-func WithRequestBody(body io.Reader) RequestOption {
+// WithRequestEncode transforms the request body with the given encoders in order.
+// It must be provided after the option setting the body.
+func WithRequestEncode(encoders ...BodyEncoder) RequestOption {
 	return func(request *Request) error {
-		buffer := &bytes.Buffer{}
-		size, err := io.Copy(buffer, body)
+		body, err := request.CapturedBody()
 		if err != nil {
 			return err
 		}
 
-		request.Body = io.NopCloser(buffer)
-		request.ContentLength = size
+		for _, encoder := range encoders {
+			if body, err = encoder(body, request.Header); err != nil {
+				return err
+			}
+		}
+
+		request.setBody(body)
 		return nil
 	}
 }
 
 // WithRequestXML XML serializes the object and sets the request body as XML.
 func WithRequestXML(object any) RequestOption {
+	return WithRequestXMLWithOptions(object, "application/xml", false)
+}
+
+// WithRequestXMLWithOptions XML serializes the object and sets the request body as XML with
+// the given Content-Type. If prolog is true, the body starts with the XML declaration.
+func WithRequestXMLWithOptions(object any, contentType string, prolog bool) RequestOption {
 	return func(request *Request) error {
 		body, err := xml.MarshalIndent(object, "", "  ")
 		if err != nil {
 			return err
 		}
 
+		if prolog {
+			body = append([]byte(xml.Header), body...)
+		}
+
 		if err = WithRequestBody(bytes.NewReader(body))(request); err != nil {
 			return err
 		}
 
-		request.Header.Add("Content-Type", "application/xml")
+		request.Header.Add("Content-Type", contentType)
 		return nil
 	}
 }
@@ -241,6 +1123,44 @@ func WithRequestJSON(object any) RequestOption {
 	}
 }
 
+// WithRequestNDJSON JSON serializes each item on a separate line and sets the request body as
+// newline-delimited JSON.
+func WithRequestNDJSON(items []any) RequestOption {
+	return func(request *Request) error {
+		body := &bytes.Buffer{}
+		encoder := json.NewEncoder(body)
+		for _, item := range items {
+			if err := encoder.Encode(item); err != nil {
+				return err
+			}
+		}
+
+		if err := WithRequestBody(body)(request); err != nil {
+			return err
+		}
+
+		request.Header.Add("Content-Type", "application/x-ndjson")
+		return nil
+	}
+}
+
+// WithRequestProtobuf serializes the protobuf message and sets the request body as protobuf.
+func WithRequestProtobuf(message interface{ Marshal() ([]byte, error) }) RequestOption {
+	return func(request *Request) error {
+		body, err := message.Marshal()
+		if err != nil {
+			return err
+		}
+
+		if err = WithRequestBody(bytes.NewReader(body))(request); err != nil {
+			return err
+		}
+
+		request.Header.Add("Content-Type", "application/x-protobuf")
+		return nil
+	}
+}
+
 // WithRequestFormURLEncoded sets the request body as form-urlencoded.
 func WithRequestFormURLEncoded(form map[string][]string) RequestOption {
 	return func(request *Request) error {
@@ -260,6 +1180,20 @@ func WithRequestFormURLEncoded(form map[string][]string) RequestOption {
 	}
 }
 
+// WithRequestFormStruct encodes the exported fields of the struct and sets the request body as
+// form-urlencoded. The field names are taken from the form tag, and the tag options omitempty and "-"
+// are supported. Slice fields are encoded as repeated keys.
+func WithRequestFormStruct(v any) RequestOption {
+	return func(request *Request) error {
+		form, err := structValues(v, "form")
+		if err != nil {
+			return err
+		}
+
+		return WithRequestFormURLEncoded(form)(request)
+	}
+}
+
 // WithRequestFormData writes the content to body using the multipart
 // writer.
 func WithRequestFormData(form map[string][]byte) RequestOption {
@@ -287,6 +1221,43 @@ func WithRequestFormData(form map[string][]byte) RequestOption {
 	}
 }
 
+// WithRequestFormDataAny writes the fields to body using the multipart writer.
+// Byte slices are written as is, readers are copied into the part, and any other
+// value is formatted with fmt.Sprint.
+func WithRequestFormDataAny(fields map[string]any) RequestOption {
+	return func(request *Request) error {
+		body := bytes.Buffer{}
+		mWriter := multipart.NewWriter(&body)
+		for key, value := range fields {
+			writer, err := mWriter.CreateFormField(key)
+			if err != nil {
+				return err
+			}
+
+			switch v := value.(type) {
+			case []byte:
+				_, err = writer.Write(v)
+			case io.Reader:
+				_, err = io.Copy(writer, v)
+			default:
+				_, err = io.WriteString(writer, fmt.Sprint(v))
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+
+		mWriter.Close()
+		if err := WithRequestBody(&body)(request); err != nil {
+			return err
+		}
+
+		request.Header.Add("Content-Type", mWriter.FormDataContentType())
+		return nil
+	}
+}
+
 // WithRequestFormDataFile reads the given files and writes it as multipart form.
 // the functional options allows you to mutate the file content before it's being written.
 func WithRequestFormDataFile(filePath, field string, opts ...func(content []byte) []byte) RequestOption {
@@ -306,6 +1277,84 @@ func WithRequestFormDataFile(filePath, field string, opts ...func(content []byte
 	}
 }
 
+// WithRequestMultipartStream streams the multipart body written by build to the transport through a
+// pipe, so the body is never buffered in memory. The build function runs in its own goroutine once the
+// transport starts reading the body. Since the body can only be read once, it can't be rewound
+// and is incompatible with retries.
+func WithRequestMultipartStream(build func(w *multipart.Writer) error) RequestOption {
+	return func(request *Request) error {
+		reader, writer := io.Pipe()
+		mWriter := multipart.NewWriter(writer)
+		request.Body = &pipeReadCloser{
+			PipeReader: reader,
+			start: func() {
+				go func() {
+					err := build(mWriter)
+					if err == nil {
+						err = mWriter.Close()
+					}
+
+					writer.CloseWithError(err)
+				}()
+			},
+		}
+		request.ContentLength = -1
+		request.GetBody = nil
+		request.bodies++
+		request.Header.Add("Content-Type", mWriter.FormDataContentType())
+		return nil
+	}
+}
+
+// quoteEscaper escapes the quoted parameters of a Content-Disposition header like the multipart package.
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// WithRequestMultipartJSON writes the metadata as a JSON part and the content of the file as a file
+// part to body using the multipart writer.
+func WithRequestMultipartJSON(jsonField string, meta any, fileField, filePath string) RequestOption {
+	return func(request *Request) error {
+		metadata, err := json.Marshal(meta)
+		if err != nil {
+			return err
+		}
+
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+
+		body := bytes.Buffer{}
+		mWriter := multipart.NewWriter(&body)
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"`, quoteEscaper.Replace(jsonField)))
+		header.Set("Content-Type", "application/json")
+		writer, err := mWriter.CreatePart(header)
+		if err != nil {
+			return err
+		}
+
+		if _, err = writer.Write(metadata); err != nil {
+			return err
+		}
+
+		if writer, err = mWriter.CreateFormFile(fileField, filepath.Base(filePath)); err != nil {
+			return err
+		}
+
+		if _, err = writer.Write(content); err != nil {
+			return err
+		}
+
+		mWriter.Close()
+		if err := WithRequestBody(&body)(request); err != nil {
+			return err
+		}
+
+		request.Header.Add("Content-Type", mWriter.FormDataContentType())
+		return nil
+	}
+}
+
 // WithRequestAuthorizationBasic encodes the credentials with basic HTTP authentication.
 // It sets the valkue in the Authorization HTTP header.
 func WithRequestAuthorizationBasic(username, password string) RequestOption {
@@ -317,6 +1366,19 @@ func WithRequestAuthorizationBasic(username, password string) RequestOption {
 	}
 }
 
+// WithRequestAuthorizationBasicFunc executes the callback to fetch the credentials, the credentials
+// from the result will be encoded with basic HTTP authentication and set in the Authorization header.
+func WithRequestAuthorizationBasicFunc(fn func(ctx context.Context) (username, password string, err error)) RequestOption {
+	return func(request *Request) error {
+		username, password, err := fn(request.Context())
+		if err != nil {
+			return err
+		}
+
+		return WithRequestAuthorizationBasic(username, password)(request)
+	}
+}
+
 // WithRequestAuthorizationBearer executes the callback to fetch a token, the token from
 // the result will be set in the Authorization header
 func WithRequestAuthorizationBearer(fn func(ctx context.Context) (string, error)) RequestOption {
@@ -338,3 +1400,189 @@ func WithRequestHeader(key string, value any) RequestOption {
 		return nil
 	}
 }
+
+// WithRequestPropagateTrace sets the W3C traceparent and tracestate headers from the trace context
+// extracted from the request context by the given extractor. Empty values are skipped.
+func WithRequestPropagateTrace(extract func(ctx context.Context) (traceparent, tracestate string)) RequestOption {
+	return func(request *Request) error {
+		traceparent, tracestate := extract(request.Context())
+		if traceparent != "" {
+			request.Header.Set("traceparent", traceparent)
+		}
+
+		if tracestate != "" {
+			request.Header.Set("tracestate", tracestate)
+		}
+
+		return nil
+	}
+}
+
+// WithRequestSOAPAction sets the SOAPAction header of the request to the quoted action, as
+// required by SOAP 1.1.
+func WithRequestSOAPAction(action string) RequestOption {
+	return func(request *Request) error {
+		request.Header.Set("SOAPAction", strconv.Quote(action))
+		return nil
+	}
+}
+
+// WithRequestExpectGzip sets the Accept-Encoding header of the request to gzip, and fails the request if
+// the response has a body which isn't gzip-encoded. Since the header is set explicitly, the transport
+// doesn't decompress the response body.
+func WithRequestExpectGzip() RequestOption {
+	return func(request *Request) error {
+		request.Header.Set("Accept-Encoding", "gzip")
+		request.expectGzip = true
+		return nil
+	}
+}
+
+// WithRequestCacheControl sets the Cache-Control header of the request to the given directives,
+// e.g. "no-cache" or "max-age=60", replacing any existing value.
+func WithRequestCacheControl(directives ...string) RequestOption {
+	return func(request *Request) error {
+		request.Header.Set("Cache-Control", strings.Join(directives, ", "))
+		return nil
+	}
+}
+
+// WithRequestHeaderFunc sets the header to the value computed by fn from the built request. The value
+// is computed before each attempt of sending the request, after all other options have been applied.
+// If fn returns an error, the request isn't sent.
+func WithRequestHeaderFunc(key string, fn func(request *Request) (string, error)) RequestOption {
+	return func(request *Request) error {
+		return WithRequestBeforeAttempt(func(req *http.Request, _ int) error {
+			bound := *request
+			bound.Request = req
+			value, err := fn(&bound)
+			if err != nil {
+				return fmt.Errorf("unable to compute header '%s': %w", key, err)
+			}
+
+			req.Header.Set(key, value)
+			return nil
+		})(request)
+	}
+}
+
+// WithRequestHeaderFromContext sets the value stored in the request context under the given key
+// as HTTP header in the request. The header is skipped when the context holds no value.
+func WithRequestHeaderFromContext(header string, key any) RequestOption {
+	return func(request *Request) error {
+		if value := request.Context().Value(key); value != nil {
+			request.Header.Set(header, fmt.Sprint(value))
+		}
+
+		return nil
+	}
+}
+
+// cancelReadCloser cancels the context of the request when the response body is closed.
+type cancelReadCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelReadCloser) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+// structValues encodes the exported fields of a struct to values keyed by the given tag.
+func structValues(v any, tag string) (url.Values, error) {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return url.Values{}, nil
+		}
+
+		value = value.Elem()
+	}
+
+	if value.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expected a struct, received %T", v)
+	}
+
+	values := url.Values{}
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get(tag), ",")
+		if name == "-" && options == "" {
+			continue
+		} else if name == "" {
+			name = field.Name
+		}
+
+		fieldValue := value.Field(i)
+		if options == "omitempty" && fieldValue.IsZero() {
+			continue
+		}
+
+		for fieldValue.Kind() == reflect.Pointer && !fieldValue.IsNil() {
+			fieldValue = fieldValue.Elem()
+		}
+
+		switch fieldValue.Kind() {
+		case reflect.Pointer:
+		case reflect.Slice, reflect.Array:
+			for j := 0; j < fieldValue.Len(); j++ {
+				values.Add(name, fmt.Sprint(fieldValue.Index(j).Interface()))
+			}
+		default:
+			values.Add(name, fmt.Sprint(fieldValue.Interface()))
+		}
+	}
+
+	return values, nil
+}
+
+// pipeReadCloser calls start on the first read, so no writer is started for bodies that are never sent.
+type pipeReadCloser struct {
+	*io.PipeReader
+	start func()
+	once  sync.Once
+}
+
+func (p *pipeReadCloser) Read(b []byte) (int, error) {
+	p.once.Do(p.start)
+	return p.PipeReader.Read(b)
+}
+
+// progressReader calls onProgress with the number of bytes read so far after each read.
+type progressReader struct {
+	reader     io.Reader
+	read       int64
+	total      int64
+	onProgress func(read, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.reader.Read(b)
+	if n > 0 {
+		p.read += int64(n)
+		p.onProgress(p.read, p.total)
+	}
+
+	return n, err
+}
+
+// exactReader fails when the underlying reader ends before remaining bytes have been read.
+type exactReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (e *exactReader) Read(p []byte) (int, error) {
+	n, err := e.reader.Read(p)
+	e.remaining -= int64(n)
+	if err == io.EOF && e.remaining > 0 {
+		return n, fmt.Errorf("request body is %d byte(s) shorter than the limit: %w", e.remaining, io.ErrUnexpectedEOF)
+	}
+
+	return n, err
+}
@@ -1,15 +1,25 @@
 package requester
 
 import (
+	"compress/gzip"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"io"
+	"math/rand"
 	"mime"
 	"mime/multipart"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -26,14 +36,253 @@ func TestDo(t *testing.T) {
 	})
 }
 
+func TestDry(t *testing.T) {
+	t.Run("errors of all options are reported", func(t *testing.T) {
+		first := fmt.Errorf("first")
+		second := fmt.Errorf("second")
+		err := New().GET(context.Background(), testURL).Dry(
+			func(request *Request) error { return first },
+			WithRequestHeader("X-Test", "test"),
+			func(request *Request) error { return second },
+		)
+
+		actual, ok := err.(interface {
+			Unwrap() []error
+		})
+
+		assert.True(t, ok)
+		assert.Equal(t, []error{first, second}, actual.Unwrap())
+	})
+}
+
+func TestCapturedBody(t *testing.T) {
+	t.Run("JSON body is returned repeatedly", func(t *testing.T) {
+		request := New().POST(context.Background(), testURL)
+		assert.NoError(t, request.Dry(WithRequestJSON(map[string]int{"id": 1})))
+
+		for i := 0; i < 2; i++ {
+			body, err := request.CapturedBody()
+			assert.NoError(t, err)
+			assert.JSONEq(t, `{"id":1}`, string(body))
+		}
+	})
+	t.Run("request without body returns nil", func(t *testing.T) {
+		body, err := New().GET(context.Background(), testURL).CapturedBody()
+		assert.NoError(t, err)
+		assert.Nil(t, body)
+	})
+}
+
+func TestRepeat(t *testing.T) {
+	t.Run("request is sent n times with bounded concurrency", func(t *testing.T) {
+		var hits, current, peak int32
+		bodies := make(chan string, 20)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits, 1)
+			n := atomic.AddInt32(&current, 1)
+			defer atomic.AddInt32(&current, -1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+
+			body, _ := io.ReadAll(r.Body)
+			bodies <- string(body)
+			time.Sleep(time.Millisecond * 5)
+		}))
+		defer server.Close()
+
+		request := New().POST(context.Background(), server.URL)
+		assert.NoError(t, request.Dry(WithRequestJSON(map[string]int{"id": 1})))
+		responses := request.Repeat(20, 4)
+		close(bodies)
+
+		assert.Len(t, responses, 20)
+		for _, response := range responses {
+			assert.NoError(t, response.Err)
+		}
+
+		for body := range bodies {
+			assert.Equal(t, `{"id":1}`, body)
+		}
+
+		assert.Equal(t, int32(20), atomic.LoadInt32(&hits))
+		assert.LessOrEqual(t, atomic.LoadInt32(&peak), int32(4))
+	})
+	t.Run("non-positive n and concurrency are handled", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer server.Close()
+
+		request := New().GET(context.Background(), server.URL)
+		assert.Nil(t, request.Repeat(-1, 2))
+		assert.Len(t, request.Repeat(2, 0), 2)
+	})
+	t.Run("clones have their own random source", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		request := New().GET(context.Background(), server.URL)
+		assert.NoError(t, request.Dry(WithRequestRetryPolicy(3, time.Microsecond, FallbackPolicyExponentialJitter, http.StatusServiceUnavailable)))
+		request.random = rand.New(rand.NewSource(1))
+
+		for _, response := range request.Repeat(8, 8) {
+			assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+		}
+	})
+	t.Run("body which can't be rewound is rejected", func(t *testing.T) {
+		request := New().POST(context.Background(), testURL)
+		assert.NoError(t, request.Dry(WithRequestBodyLimited(strings.NewReader("body"), 4)))
+
+		responses := request.Repeat(2, 2)
+		assert.Len(t, responses, 2)
+		for _, response := range responses {
+			assert.EqualError(t, response.Err, "request body can't be rewound to be repeated")
+		}
+	})
+}
+
+func TestDownload(t *testing.T) {
+	content := strings.Repeat("0123456789", 1000)
+
+	t.Run("download resumes after dropped connection", func(t *testing.T) {
+		ranges := []string{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ranges = append(ranges, r.Header.Get("Range"))
+			if len(ranges) == 1 {
+				w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+				w.Write([]byte(content[:4000]))
+				w.(http.Flusher).Flush()
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+				return
+			}
+
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+		}))
+		defer server.Close()
+
+		filePath := filepath.Join(t.TempDir(), "download")
+		request := New().GET(context.Background(), server.URL)
+		assert.NoError(t, request.Dry(WithRequestRetryPolicy(3, 0, FallbackPolicyLinear)))
+		assert.NoError(t, request.Download(filePath))
+
+		actual, err := os.ReadFile(filePath)
+		assert.NoError(t, err)
+		assert.Equal(t, content, string(actual))
+		assert.Equal(t, []string{"", "bytes=4000-"}, ranges)
+		assert.Empty(t, request.Header.Get("Range"))
+	})
+	t.Run("caller Range header is kept", func(t *testing.T) {
+		ranges := []string{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ranges = append(ranges, r.Header.Get("Range"))
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+		}))
+		defer server.Close()
+
+		filePath := filepath.Join(t.TempDir(), "download")
+		request := New().GET(context.Background(), server.URL)
+		assert.NoError(t, request.Dry(WithRequestHeader("Range", "bytes=0-9")))
+		assert.NoError(t, request.Download(filePath))
+
+		actual, err := os.ReadFile(filePath)
+		assert.NoError(t, err)
+		assert.Equal(t, content[:10], string(actual))
+		assert.Equal(t, []string{"bytes=0-9"}, ranges)
+		assert.Equal(t, "bytes=0-9", request.Header.Get("Range"))
+	})
+	t.Run("request timeout applies", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Millisecond * 500):
+			}
+
+			w.Write([]byte(content))
+		}))
+		defer server.Close()
+
+		var err error
+		request := New().GET(context.Background(), server.URL)
+		assert.NoError(t, request.Dry(WithRequestTimeout(time.Millisecond*50)))
+		elapsed := Elapsed(func() {
+			err = request.Download(filepath.Join(t.TempDir(), "download"))
+		})
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, elapsed, time.Millisecond*300)
+	})
+	t.Run("unexpected status code returns error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer server.Close()
+
+		err := New().GET(context.Background(), server.URL).Download(filepath.Join(t.TempDir(), "download"))
+		assert.EqualError(t, err, "received HTTP status code 404 in attempt 1")
+	})
+}
+
+func TestCurl(t *testing.T) {
+	t.Run("command contains method, URL, headers and body", func(t *testing.T) {
+		request := New().POST(context.Background(), testURL)
+		err := request.Dry(
+			WithRequestJSON(map[string]int{"id": 1}),
+			WithRequestAuthorizationBasic("user", "pass"),
+		)
+
+		assert.NoError(t, err)
+		curl := request.Curl()
+		assert.Contains(t, curl, "curl -X POST 'https://test.com'")
+		assert.Contains(t, curl, "-H 'Content-Type: application/json'")
+		assert.Contains(t, curl, "-H 'Authorization: REDACTED'")
+		assert.Contains(t, curl, `--data '{"id":1}'`)
+
+		body, err := io.ReadAll(request.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"id":1}`, string(body))
+	})
+	t.Run("authorization is revealed when unredacted", func(t *testing.T) {
+		request := New().GET(context.Background(), testURL)
+		err := request.Dry(WithRequestAuthorizationBasic("123", "321"))
+
+		assert.NoError(t, err)
+		assert.Contains(t, request.CurlUnredacted(), "-H 'Authorization: Basic MTIzOjMyMQ=='")
+	})
+	t.Run("body which can't be rewound is left untouched", func(t *testing.T) {
+		request := New().POST(context.Background(), testURL)
+		err := request.Dry(WithRequestBodyLimited(strings.NewReader("stream"), 6))
+
+		assert.NoError(t, err)
+		assert.NotContains(t, request.Curl(), "--data")
+
+		body, err := io.ReadAll(request.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "stream", string(body))
+	})
+}
+
 func TestWithRequestRetryPolicy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
 	t.Run("exponential fallback", func(t *testing.T) {
 		var err error
 		elapsed := Elapsed(func() {
 			err = New().
-				GET(context.Background(), "http://www.google.com:81").
+				GET(context.Background(), server.URL).
 				Do(
 					WithRequestTimeout(time.Millisecond),
+					WithRequestTimeoutRetryReset(),
 					WithRequestRetryPolicy(3, time.Millisecond, FallbackPolicyExponential),
 				).Handle()
 		})
@@ -51,9 +300,10 @@ func TestWithRequestRetryPolicy(t *testing.T) {
 		var err error
 		elapsed := Elapsed(func() {
 			err = New().
-				GET(context.Background(), "http://www.google.com:81").
+				GET(context.Background(), server.URL).
 				Do(
 					WithRequestTimeout(time.Millisecond),
+					WithRequestTimeoutRetryReset(),
 					WithRequestRetryPolicy(3, time.Millisecond, FallbackPolicyLinear),
 				).Handle()
 		})
@@ -62,60 +312,908 @@ func TestWithRequestRetryPolicy(t *testing.T) {
 			Unwrap() []error
 		})
 
-		assert.True(t, ok)
-		assert.Len(t, actual.Unwrap(), 3)
-		assert.Less(t, time.Millisecond*6, elapsed)
+		assert.True(t, ok)
+		assert.Len(t, actual.Unwrap(), 3)
+		assert.Less(t, time.Millisecond*6, elapsed)
+	})
+
+	t.Run("timeout covers all attempts", func(t *testing.T) {
+		err := New().
+			GET(context.Background(), server.URL).
+			Do(
+				WithRequestTimeout(time.Millisecond),
+				WithRequestRetryPolicy(3, time.Millisecond, FallbackPolicyLinear),
+			).Handle()
+
+		actual, ok := err.(interface {
+			Unwrap() []error
+		})
+
+		assert.True(t, ok)
+		assert.Len(t, actual.Unwrap(), 1)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestFallbackPolicyExponentialJitter(t *testing.T) {
+	t.Run("delays stay within the full jitter bounds", func(t *testing.T) {
+		request := New().GET(context.Background(), testURL)
+		request.FallbackDuration = time.Millisecond * 10
+		request.FallbackPolicy = FallbackPolicyExponentialJitter
+		request.random = rand.New(rand.NewSource(1))
+
+		delays := []time.Duration{}
+		for attempt := 1; attempt <= 5; attempt++ {
+			delay := request.backoff(attempt)
+			assert.GreaterOrEqual(t, delay, time.Duration(0))
+			assert.LessOrEqual(t, delay, request.FallbackDuration*time.Duration(attempt*attempt))
+			delays = append(delays, delay)
+		}
+
+		request.random = rand.New(rand.NewSource(1))
+		for attempt := 1; attempt <= 5; attempt++ {
+			assert.Equal(t, delays[attempt-1], request.backoff(attempt))
+		}
+	})
+}
+
+func TestFallbackPolicyDecorrelatedJitter(t *testing.T) {
+	t.Run("delays stay within the decorrelated bounds", func(t *testing.T) {
+		request := New().GET(context.Background(), testURL)
+		request.FallbackDuration = time.Millisecond * 10
+		request.FallbackPolicy = FallbackPolicyDecorrelatedJitter
+		request.MaxBackoff = time.Millisecond * 200
+
+		previous := request.FallbackDuration
+		for attempt := 1; attempt <= 10; attempt++ {
+			delay := request.backoff(attempt)
+			assert.LessOrEqual(t, request.FallbackDuration, delay)
+			assert.LessOrEqual(t, delay, min(request.MaxBackoff, previous*3))
+			previous = delay
+		}
+	})
+}
+
+func TestWithRequestRetryMaxBackoff(t *testing.T) {
+	t.Run("exponential waits are capped", func(t *testing.T) {
+		var mu sync.Mutex
+		attempts := []time.Time{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			attempts = append(attempts, time.Now())
+			mu.Unlock()
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		New().GET(context.Background(), server.URL).Do(
+			WithRequestRetryPolicy(5, time.Millisecond*20, FallbackPolicyExponential, http.StatusServiceUnavailable),
+			WithRequestRetryMaxBackoff(time.Millisecond*30),
+		)
+
+		assert.Len(t, attempts, 5)
+		for i := 1; i < len(attempts); i++ {
+			assert.Less(t, attempts[i].Sub(attempts[i-1]), time.Millisecond*100)
+		}
+	})
+}
+
+func TestWithRequestRetryRespectRetryAfter(t *testing.T) {
+	retryAfter := func(value string) *http.Response {
+		response := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+		if value != "" {
+			response.Header.Set("Retry-After", value)
+		}
+
+		return response
+	}
+
+	request := New().GET(context.Background(), testURL)
+	assert.NoError(t, request.Dry(WithRequestRetryPolicy(3, time.Millisecond, FallbackPolicyLinear, http.StatusTooManyRequests)))
+
+	t.Run("seconds form is honored", func(t *testing.T) {
+		delay, ok := request.retryAfter(retryAfter("120"))
+		assert.True(t, ok)
+		assert.Equal(t, time.Minute*2, delay)
+	})
+	t.Run("HTTP-date form is honored", func(t *testing.T) {
+		delay, ok := request.retryAfter(retryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)))
+		assert.True(t, ok)
+		assert.Greater(t, delay, time.Second*58)
+		assert.LessOrEqual(t, delay, time.Minute)
+	})
+	t.Run("absent or unparseable header falls back to the policy", func(t *testing.T) {
+		_, ok := request.retryAfter(retryAfter(""))
+		assert.False(t, ok)
+		_, ok = request.retryAfter(retryAfter("soon"))
+		assert.False(t, ok)
+	})
+	t.Run("header of a non-retryable status is ignored", func(t *testing.T) {
+		response := retryAfter("120")
+		response.StatusCode = http.StatusOK
+		_, ok := request.retryAfter(response)
+		assert.False(t, ok)
+	})
+	t.Run("header is ignored when opted out", func(t *testing.T) {
+		request := New().GET(context.Background(), testURL)
+		assert.NoError(t, request.Dry(
+			WithRequestRetryPolicy(3, time.Millisecond, FallbackPolicyLinear, http.StatusTooManyRequests),
+			WithRequestRetryRespectRetryAfter(false),
+		))
+
+		_, ok := request.retryAfter(retryAfter("120"))
+		assert.False(t, ok)
+	})
+	t.Run("retry waits for the requested cooldown", func(t *testing.T) {
+		var hits int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&hits, 1) == 1 {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer server.Close()
+
+		var response *Response
+		elapsed := Elapsed(func() {
+			response = New().GET(context.Background(), server.URL).Do(
+				WithRequestRetryPolicy(3, time.Millisecond, FallbackPolicyLinear, http.StatusServiceUnavailable),
+			)
+		})
+
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.GreaterOrEqual(t, elapsed, time.Second)
+	})
+}
+
+func TestWithRequestBeforeAttempt(t *testing.T) {
+	t.Run("hook runs before each attempt", func(t *testing.T) {
+		received := []string{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received = append(received, r.Header.Get("X-Attempt"))
+			if len(received) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer server.Close()
+
+		err := New().GET(context.Background(), server.URL).Do(
+			WithRequestRetryPolicy(3, 0, FallbackPolicyLinear, http.StatusServiceUnavailable),
+			WithRequestBeforeAttempt(func(request *http.Request, attempt int) error {
+				request.Header.Set("X-Attempt", fmt.Sprint(attempt))
+				return nil
+			}),
+		).Err
+
+		assert.Error(t, err)
+		assert.Equal(t, []string{"1", "2", "3"}, received)
+	})
+	t.Run("hook error stops the request", func(t *testing.T) {
+		err := New().GET(context.Background(), testURL).Do(
+			WithRequestBeforeAttempt(func(request *http.Request, attempt int) error {
+				return fmt.Errorf("unable to sign request")
+			}),
+		).Err
+
+		assert.EqualError(t, err, "unable to sign request")
+	})
+}
+
+func TestRetryRewindsBody(t *testing.T) {
+	t.Run("third attempt receives the full JSON payload", func(t *testing.T) {
+		received := []string{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			received = append(received, string(body))
+			if len(received) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer server.Close()
+
+		response := New().POST(context.Background(), server.URL).Do(
+			WithRequestRetryPolicy(3, 0, FallbackPolicyLinear, http.StatusServiceUnavailable),
+			WithRequestJSON(map[string]string{"name": "github"}),
+		)
+
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, []string{`{"name":"github"}`, `{"name":"github"}`, `{"name":"github"}`}, received)
+	})
+}
+
+func TestRetryClosesRetriedResponses(t *testing.T) {
+	t.Run("connection is reused across attempts", func(t *testing.T) {
+		var hits, connections int32
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&hits, 1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte("unavailable"))
+			}
+		}))
+		server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				atomic.AddInt32(&connections, 1)
+			}
+		}
+		server.Start()
+		defer server.Close()
+
+		response := New(WithClient(server.Client())).GET(context.Background(), server.URL).Do(
+			WithRequestRetryPolicy(3, 0, FallbackPolicyLinear, http.StatusServiceUnavailable),
+		)
+
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&hits))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&connections))
+	})
+	t.Run("retried response is closed before the backoff", func(t *testing.T) {
+		var closed time.Time
+		attempts := []time.Time{}
+		transport := roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			attempts = append(attempts, time.Now())
+			body := &closeFunc{Reader: strings.NewReader("unavailable"), close: func() { closed = time.Now() }}
+			return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: body, Request: request}, nil
+		})
+
+		New().GET(context.Background(), testURL).Do(
+			WithRequestTransport(transport),
+			WithRequestRetryPolicy(2, time.Millisecond*100, FallbackPolicyLinear, http.StatusServiceUnavailable),
+		)
+
+		assert.Len(t, attempts, 2)
+		assert.False(t, closed.IsZero())
+		assert.Less(t, closed.Sub(attempts[0]), time.Millisecond*50)
+	})
+}
+
+// closeFunc is a body which calls close when it is closed.
+type closeFunc struct {
+	io.Reader
+	close func()
+}
+
+func (c *closeFunc) Close() error {
+	c.close()
+	return nil
+}
+
+func TestWithRequestRetryExcludeStatus(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if r.URL.Path == "/unavailable" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			w.WriteHeader(http.StatusNotImplemented)
+		}
+	}))
+	defer server.Close()
+
+	options := WithRequestOptions(
+		WithRequestRetryPolicy(3, 0, FallbackPolicyLinear, http.StatusNotImplemented, http.StatusServiceUnavailable),
+		WithRequestRetryExcludeStatus(http.StatusNotImplemented),
+	)
+
+	t.Run("503 is retried", func(t *testing.T) {
+		atomic.StoreInt32(&hits, 0)
+		New().GET(context.Background(), server.URL, "unavailable").Do(options)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&hits))
+	})
+	t.Run("501 is not retried", func(t *testing.T) {
+		atomic.StoreInt32(&hits, 0)
+		response := New().GET(context.Background(), server.URL, "unimplemented").Do(options)
+		assert.NoError(t, response.Err)
+		assert.Equal(t, http.StatusNotImplemented, response.StatusCode)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+	})
+}
+
+func TestWait(t *testing.T) {
+	t.Run("elapsed wait is not cancelled", func(t *testing.T) {
+		request := New().GET(context.Background(), testURL)
+		assert.False(t, request.wait(time.Millisecond))
+	})
+	t.Run("cancelled context interrupts the wait", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		request := New().GET(ctx, testURL)
+		time.AfterFunc(time.Millisecond*10, cancel)
+
+		var cancelled bool
+		elapsed := Elapsed(func() { cancelled = request.wait(time.Second) })
+
+		assert.True(t, cancelled)
+		assert.Less(t, elapsed, time.Millisecond*500)
+	})
+	t.Run("wait only allocates a timer", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		request := New().GET(ctx, testURL)
+
+		// An absolute bound, since the race detector changes the allocations of a context with timeout.
+		assert.LessOrEqual(t, testing.AllocsPerRun(100, func() { request.wait(time.Microsecond) }), float64(3))
+	})
+}
+
+func TestWithRequestTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	t.Run("times out after given duration", func(t *testing.T) {
+		var err error
+		elapsed := Elapsed(func() {
+			err = New().
+				GET(context.Background(), server.URL).
+				Do(WithRequestTimeout(time.Millisecond * 100)).Err
+		})
+
+		assert.LessOrEqual(t, time.Millisecond*100, elapsed)
+		assert.Less(t, elapsed, time.Millisecond*500)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestWithRequestTimeoutContextDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	t.Run("context deadline shorter than timeout wins", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+		defer cancel()
+
+		var err error
+		elapsed := Elapsed(func() {
+			err = New().GET(ctx, server.URL).Do(
+				WithRequestTimeout(time.Millisecond*500),
+				WithRequestRetryPolicy(5, time.Millisecond*10, FallbackPolicyLinear),
+			).Err
+		})
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, elapsed, time.Millisecond*300)
+	})
+	t.Run("timeout shorter than context deadline wins", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*500)
+		defer cancel()
+
+		var err error
+		elapsed := Elapsed(func() {
+			err = New().GET(ctx, server.URL).Do(WithRequestTimeout(time.Millisecond * 50)).Err
+		})
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, elapsed, time.Millisecond*300)
+		assert.Zero(t, http.DefaultClient.Timeout)
+	})
+}
+
+func TestWithRequestTimeoutRetryReset(t *testing.T) {
+	var mu sync.Mutex
+	waited := []time.Duration{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+
+		mu.Lock()
+		waited = append(waited, time.Since(start))
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	t.Run("each attempt gets the full timeout", func(t *testing.T) {
+		err := New().GET(context.Background(), server.URL).Do(
+			WithRequestTimeout(time.Millisecond*50),
+			WithRequestTimeoutRetryReset(),
+			WithRequestRetryPolicy(3, 0, FallbackPolicyLinear),
+		).Err
+		server.Close()
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Len(t, waited, 3)
+		for _, duration := range waited {
+			assert.GreaterOrEqual(t, duration, time.Millisecond*40)
+			assert.Less(t, duration, time.Millisecond*500)
+		}
+	})
+}
+
+func TestWithRequestTTFBTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		}
+
+		w.Write([]byte("body"))
+	}))
+	defer server.Close()
+
+	t.Run("slow server trips the timeout", func(t *testing.T) {
+		var err error
+		elapsed := Elapsed(func() {
+			err = New().GET(context.Background(), server.URL, "slow").Do(WithRequestTTFBTimeout(time.Millisecond * 20)).Err
+		})
+
+		assert.ErrorIs(t, err, ErrFirstByteTimeout)
+		assert.Less(t, elapsed, time.Millisecond*500)
+	})
+	t.Run("body can be read after the first byte", func(t *testing.T) {
+		response := New().GET(context.Background(), server.URL).Do(WithRequestTTFBTimeout(time.Millisecond * 20))
+		assert.NoError(t, response.Err)
+
+		time.Sleep(time.Millisecond * 40)
+		body, err := io.ReadAll(response.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "body", string(body))
+	})
+}
+
+type roundTripperFunc func(request *http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return fn(request)
+}
+
+func TestWithRequestMaxRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1":
+			http.Redirect(w, r, "/2", http.StatusFound)
+		case "/2":
+			http.Redirect(w, r, "/3", http.StatusFound)
+		case "/3":
+			http.Redirect(w, r, "/done", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+
+	t.Run("request stops after n redirects", func(t *testing.T) {
+		httpClient := &http.Client{}
+		response := New(WithClient(httpClient)).GET(context.Background(), server.URL, "1").Do(WithRequestMaxRedirects(1))
+
+		assert.NoError(t, response.Err)
+		assert.Equal(t, http.StatusFound, response.StatusCode)
+		assert.Equal(t, "/2", response.Request.URL.Path)
+		assert.Equal(t, "/3", response.Header.Get("Location"))
+		assert.Nil(t, httpClient.CheckRedirect)
+	})
+	t.Run("request follows redirects within the limit", func(t *testing.T) {
+		response := New().GET(context.Background(), server.URL, "1").Do(WithRequestMaxRedirects(3))
+
+		assert.NoError(t, response.Err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, "/done", response.Request.URL.Path)
+	})
+}
+
+func TestWithRequestTransport(t *testing.T) {
+	t.Run("per-request transport is used", func(t *testing.T) {
+		used := false
+		transport := roundTripperFunc(func(request *http.Request) (*http.Response, error) {
+			used = true
+			return &http.Response{StatusCode: http.StatusTeapot, Body: http.NoBody, Request: request}, nil
+		})
+
+		httpClient := &http.Client{}
+		client := New(WithClient(httpClient))
+		response := client.GET(context.Background(), testURL).Do(WithRequestTransport(transport))
+
+		assert.NoError(t, response.Err)
+		assert.True(t, used)
+		assert.Equal(t, http.StatusTeapot, response.StatusCode)
+		assert.Nil(t, httpClient.Transport)
+		assert.Equal(t, httpClient, client.GET(context.Background(), testURL).Client)
+	})
+}
+
+func TestWithRequestOn1xx(t *testing.T) {
+	t.Run("early hints are surfaced", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Link", "</style.css>; rel=preload; as=style")
+			w.WriteHeader(http.StatusEarlyHints)
+			w.Header().Del("Link")
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		codes := []int{}
+		links := []string{}
+		response := New().GET(context.Background(), server.URL).Do(WithRequestOn1xx(func(code int, header http.Header) {
+			codes = append(codes, code)
+			links = append(links, header.Get("Link"))
+		}))
+
+		assert.NoError(t, response.Err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, []int{http.StatusEarlyHints}, codes)
+		assert.Equal(t, []string{"</style.css>; rel=preload; as=style"}, links)
+	})
+}
+
+func TestWithRequestURL(t *testing.T) {
+	t.Run("URL being set in request", func(t *testing.T) {
+		request := New().
+			GET(context.Background(), testURL)
+		err := request.Dry(WithRequestURL("https://test.no"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "https://test.no", request.URL.String())
+	})
+	t.Run("absolute URL replaces the base URL", func(t *testing.T) {
+		request := New(WithBaseURL("https://api.test.no/v1")).GET(context.Background(), "users")
+		err := request.Dry(WithRequestURL("https://other.test.no/health"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "https://other.test.no/health", request.URL.String())
+		assert.Equal(t, "other.test.no", request.Host)
+	})
+}
+
+func TestWithRequestRelativeURL(t *testing.T) {
+	t.Run("path is joined with the base URL", func(t *testing.T) {
+		request := New(WithBaseURL("https://api.test.no/v1")).GET(context.Background(), "users")
+		err := request.Dry(WithRequestRelativeURL("orders/42?expand=items"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "https://api.test.no/v1/orders/42?expand=items", request.URL.String())
+	})
+	t.Run("path is joined with the prefix", func(t *testing.T) {
+		request := New(WithBaseURL("https://api.test.no")).WithPrefix("v2").GET(context.Background())
+		err := request.Dry(WithRequestRelativeURL("/orders"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "https://api.test.no/v2/orders", request.URL.String())
+	})
+	t.Run("absolute URL is rejected", func(t *testing.T) {
+		request := New(WithBaseURL("https://api.test.no")).GET(context.Background())
+		assert.Error(t, request.Dry(WithRequestRelativeURL("https://other.test.no")))
+	})
+	t.Run("client without base URL fails", func(t *testing.T) {
+		request := New().GET(context.Background(), testURL)
+		assert.Error(t, request.Dry(WithRequestRelativeURL("orders")))
+	})
+}
+
+func TestWithRequestURLQuery(t *testing.T) {
+	t.Run("query being set in the URL", func(t *testing.T) {
+		request := New().
+			GET(context.Background(), testURL)
+		err := request.Dry(WithRequestURLQuery(map[string][]any{
+			"id": {"123", 321},
+		}))
+
+		assert.NoError(t, err)
+		assert.Equal(t, request.URL.String(), fmt.Sprintf("%s?id=123&id=321", testURL))
+	})
+}
+
+func TestWithRequestQueryBracketed(t *testing.T) {
+	t.Run("keys with multiple values are bracketed", func(t *testing.T) {
+		request := New().GET(context.Background(), testURL)
+		err := request.Dry(WithRequestQueryBracketed(map[string][]any{
+			"tags": {"a", "b"},
+			"id":   {1},
+		}))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "id=1&tags%5B%5D=a&tags%5B%5D=b", request.URL.RawQuery)
+		assert.Equal(t, []string{"a", "b"}, request.URL.Query()["tags[]"])
+	})
+}
+
+func TestWithRequestDedupeQuery(t *testing.T) {
+	t.Run("duplicate pairs are collapsed", func(t *testing.T) {
+		request := New().GET(context.Background(), fmt.Sprintf("%s?id=1", testURL))
+		err := request.Dry(WithRequestURLQuery(map[string][]any{
+			"id": {1, 2},
+		}))
+		assert.NoError(t, err)
+		assert.Equal(t, "id=1&id=1&id=2", request.URL.RawQuery)
+
+		assert.NoError(t, request.Dry(WithRequestDedupeQuery()))
+		assert.Equal(t, "id=1&id=2", request.URL.RawQuery)
+	})
+}
+
+func TestWithRequestMaxURLLength(t *testing.T) {
+	query := map[string][]any{"q": {strings.Repeat("a", 2000)}}
+
+	t.Run("huge query trips the limit", func(t *testing.T) {
+		request := New().GET(context.Background(), testURL)
+		err := request.Dry(WithRequestMaxURLLength(2000), WithRequestURLQuery(query))
+
+		assert.ErrorContains(t, err, "exceeds the maximum of 2000")
+	})
+	t.Run("request is not sent when the limit is exceeded", func(t *testing.T) {
+		sent := false
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sent = true
+		}))
+		defer server.Close()
+
+		err := New().GET(context.Background(), server.URL).Do(WithRequestMaxURLLength(2000), WithRequestURLQuery(query)).Err
+
+		assert.Error(t, err)
+		assert.False(t, sent)
+	})
+	t.Run("short URL passes", func(t *testing.T) {
+		request := New().GET(context.Background(), testURL)
+		assert.NoError(t, request.Dry(WithRequestMaxURLLength(2000)))
+	})
+}
+
+func TestWithRequestStrict(t *testing.T) {
+	t.Run("body set twice returns error", func(t *testing.T) {
+		request := New().POST(context.Background(), testURL)
+		err := request.Dry(
+			WithRequestStrict(),
+			WithRequestJSON(map[string]int{"id": 1}),
+			WithRequestXML(&struct {
+				XMLName xml.Name `xml:"test"`
+			}{}),
+		)
+
+		assert.ErrorContains(t, err, "strict mode: request body was set 2 times")
+	})
+	t.Run("Content-Type set twice returns error", func(t *testing.T) {
+		request := New().POST(context.Background(), testURL)
+		err := request.Dry(
+			WithRequestStrict(),
+			WithRequestHeader("Content-Type", "text/plain"),
+			WithRequestJSON(map[string]int{"id": 1}),
+		)
+
+		assert.ErrorContains(t, err, "strict mode: Content-Type was set 2 times")
+	})
+	t.Run("single body passes", func(t *testing.T) {
+		request := New().POST(context.Background(), testURL)
+		assert.NoError(t, request.Dry(WithRequestStrict(), WithRequestJSON(map[string]int{"id": 1})))
+	})
+}
+
+func TestWithRequestBody(t *testing.T) {
+	t.Run("body being set", func(t *testing.T) {
+		request := New().
+			GET(context.Background(), testURL)
+		err := request.Dry(WithRequestBody(strings.NewReader("123")))
+
+		assert.NoError(t, err)
+		body, err := io.ReadAll(request.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "123", string(body))
 	})
 }
 
-func TestWithRequestTimeout(t *testing.T) {
-	t.Run("times out after given duration", func(t *testing.T) {
-		var err error
-		elapsed := Elapsed(func() {
-			err = New().
-				GET(context.Background(), "http://www.google.com:81").
-				Do(WithRequestTimeout(time.Millisecond * 100)).Err
+func TestWithRequestBodyBytes(t *testing.T) {
+	t.Run("body is reused across multiple sends", func(t *testing.T) {
+		bodies := make(chan string, 2)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			bodies <- string(body)
 		})
+		first := httptest.NewServer(handler)
+		defer first.Close()
+		second := httptest.NewServer(handler)
+		defer second.Close()
 
-		assert.Less(t, time.Millisecond*100, elapsed)
-		assert.Error(t, err)
+		request := New().POST(context.Background(), first.URL)
+		assert.NoError(t, request.Do(WithRequestBodyBytes([]byte("payload"))).Err)
+		assert.NoError(t, request.Do(WithRequestURL(second.URL)).Err)
+
+		assert.Equal(t, "payload", <-bodies)
+		assert.Equal(t, "payload", <-bodies)
 	})
 }
 
-func TestWithRequestURL(t *testing.T) {
-	t.Run("URL being set in request", func(t *testing.T) {
-		request := New().
-			GET(context.Background(), testURL)
-		err := request.Dry(WithRequestURL("https://test.no"))
+func TestWithRequestBodyLimited(t *testing.T) {
+	var received []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	t.Run("source is truncated at the limit", func(t *testing.T) {
+		err := New().POST(context.Background(), server.URL).
+			Do(WithRequestBodyLimited(strings.NewReader("0123456789"), 5)).Err
 
 		assert.NoError(t, err)
-		assert.Equal(t, "https://test.no", request.URL.String())
+		assert.Equal(t, "01234", string(received))
+	})
+	t.Run("shorter source returns error", func(t *testing.T) {
+		err := New().POST(context.Background(), server.URL).
+			Do(WithRequestBodyLimited(strings.NewReader("012"), 5)).Err
+
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
 	})
 }
 
-func TestWithRequestURLQuery(t *testing.T) {
-	t.Run("query being set in the URL", func(t *testing.T) {
-		request := New().
-			GET(context.Background(), testURL)
-		err := request.Dry(WithRequestURLQuery(map[string][]any{
-			"id": {"123", 321},
+func TestWithRequestBodyProgress(t *testing.T) {
+	t.Run("final callback reports the whole body as sent", func(t *testing.T) {
+		var received int64
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received, _ = io.Copy(io.Discard, r.Body)
+		}))
+		defer server.Close()
+
+		const total = 1 << 20
+		var calls int
+		var sent int64
+		response := New().POST(context.Background(), server.URL).Do(
+			WithRequestBodyProgress(io.LimitReader(zeroReader{}, total), total, func(s, tot int64) {
+				calls++
+				sent = s
+				assert.Equal(t, int64(total), tot)
+			}),
+		)
+
+		assert.NoError(t, response.Err)
+		assert.Greater(t, calls, 1)
+		assert.Equal(t, int64(total), sent)
+		assert.Equal(t, int64(total), received)
+	})
+}
+
+func TestWithRequestBodyFile(t *testing.T) {
+	t.Run("file content is sent as raw body", func(t *testing.T) {
+		var body []byte
+		var contentType string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ = io.ReadAll(r.Body)
+			contentType = r.Header.Get("Content-Type")
 		}))
+		defer server.Close()
+
+		filePath := filepath.Join(t.TempDir(), "payload.json")
+		assert.NoError(t, os.WriteFile(filePath, []byte(`{"id":1}`), 0o600))
+
+		err := New(WithBaseURL(server.URL)).
+			PUT(context.Background()).
+			Do(WithRequestBodyFile(filePath)).
+			Handle(WithResponseStatusCodeAssertion(http.StatusOK))
 
 		assert.NoError(t, err)
-		assert.Equal(t, request.URL.String(), fmt.Sprintf("%s?id=123&id=321", testURL))
+		assert.Equal(t, `{"id":1}`, string(body))
+		assert.Equal(t, "application/json", contentType)
+	})
+	t.Run("content type is sniffed for unknown extensions", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "payload")
+		assert.NoError(t, os.WriteFile(filePath, []byte("<html><body></body></html>"), 0o600))
+
+		request := New().PUT(context.Background(), testURL)
+		err := request.Dry(WithRequestBodyFile(filePath))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "text/html; charset=utf-8", request.Header.Get("Content-Type"))
+		assert.Equal(t, int64(26), request.ContentLength)
 	})
 }
 
-func TestWithRequestBody(t *testing.T) {
-	t.Run("body being set", func(t *testing.T) {
-		request := New().
-			GET(context.Background(), testURL)
-		err := request.Dry(WithRequestBody(strings.NewReader("123")))
+func TestWithRequestAutoDetectContentType(t *testing.T) {
+	t.Run("PNG body is detected", func(t *testing.T) {
+		request := New().POST(context.Background(), testURL)
+		err := request.Dry(
+			WithRequestBodyBytes([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")),
+			WithRequestAutoDetectContentType(),
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "image/png", request.Header.Get("Content-Type"))
+	})
+	t.Run("JSON body is detected", func(t *testing.T) {
+		request := New().POST(context.Background(), testURL)
+		err := request.Dry(
+			WithRequestBody(strings.NewReader(`{"id":1}`)),
+			WithRequestAutoDetectContentType(),
+		)
 
 		assert.NoError(t, err)
+		assert.Equal(t, "application/json", request.Header.Get("Content-Type"))
 		body, err := io.ReadAll(request.Body)
 		assert.NoError(t, err)
-		assert.Equal(t, "123", string(body))
+		assert.Equal(t, `{"id":1}`, string(body))
+	})
+	t.Run("existing Content-Type is kept", func(t *testing.T) {
+		request := New().POST(context.Background(), testURL)
+		err := request.Dry(
+			WithRequestHeader("Content-Type", "text/csv"),
+			WithRequestBody(strings.NewReader("a,b")),
+			WithRequestAutoDetectContentType(),
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "text/csv", request.Header.Get("Content-Type"))
+	})
+	t.Run("streamed body is peeked without being consumed", func(t *testing.T) {
+		request := New().POST(context.Background(), testURL)
+		err := request.Dry(
+			WithRequestBodyLimited(strings.NewReader("<html><body>hello</body></html>"), 31),
+			WithRequestAutoDetectContentType(),
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "text/html; charset=utf-8", request.Header.Get("Content-Type"))
+		body, err := io.ReadAll(request.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "<html><body>hello</body></html>", string(body))
+	})
+}
+
+func TestReusableBody(t *testing.T) {
+	type TestXML struct {
+		Id int `xml:"id"`
+	}
+
+	bodies := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- string(body)
+	}))
+	defer server.Close()
+
+	options := map[string]RequestOption{
+		"JSON":           WithRequestJSON(map[string]int{"id": 1}),
+		"XML":            WithRequestXML(&TestXML{Id: 1}),
+		"form":           WithRequestFormURLEncoded(map[string][]string{"id": {"1"}}),
+		"multipart form": WithRequestFormData(map[string][]byte{"id": []byte("1")}),
+	}
+
+	for name, option := range options {
+		t.Run(fmt.Sprintf("%s body is identical when sent twice", name), func(t *testing.T) {
+			request := New().POST(context.Background(), server.URL)
+			assert.NoError(t, request.Do(option).Err)
+			assert.NoError(t, request.Do().Err)
+
+			first, second := <-bodies, <-bodies
+			assert.NotEmpty(t, first)
+			assert.Equal(t, first, second)
+		})
+	}
+}
+
+func TestWithRequestEncode(t *testing.T) {
+	t.Run("JSON body is gzipped and base64 encoded", func(t *testing.T) {
+		var result map[string]int
+		var contentEncoding, transferEncoding string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			contentEncoding = r.Header.Get("Content-Encoding")
+			transferEncoding = r.Header.Get("Content-Transfer-Encoding")
+			reader, err := gzip.NewReader(base64.NewDecoder(base64.StdEncoding, r.Body))
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			if err = json.NewDecoder(reader).Decode(&result); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		}))
+		defer server.Close()
+
+		err := New().POST(context.Background(), server.URL).Do(
+			WithRequestJSON(map[string]int{"id": 1}),
+			WithRequestEncode(BodyEncoderGzip, BodyEncoderBase64),
+		).Handle(WithResponseStatusCodeAssertion(http.StatusOK))
+
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]int{"id": 1}, result)
+		assert.Equal(t, "gzip", contentEncoding)
+		assert.Equal(t, "base64", transferEncoding)
 	})
 }
 
@@ -150,6 +1248,33 @@ func TestWithRequestXML(t *testing.T) {
 
 }
 
+func TestWithRequestXMLWithOptions(t *testing.T) {
+	type TestXML struct {
+		XMLName xml.Name `xml:"test"`
+		Name    string   `xml:"name"`
+	}
+
+	t.Run("prolog and custom content type are set", func(t *testing.T) {
+		request := New().POST(context.Background(), testURL)
+		err := request.Dry(WithRequestXMLWithOptions(&TestXML{Name: "github"}, "text/xml; charset=utf-8", true))
+
+		assert.NoError(t, err)
+		body, err := io.ReadAll(request.Body)
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(body), `<?xml version="1.0" encoding="UTF-8"?>`+"\n<test>"))
+		assert.Equal(t, "text/xml; charset=utf-8", request.Header.Get("Content-Type"))
+	})
+	t.Run("prolog is omitted", func(t *testing.T) {
+		request := New().POST(context.Background(), testURL)
+		err := request.Dry(WithRequestXMLWithOptions(&TestXML{Name: "github"}, "text/xml", false))
+
+		assert.NoError(t, err)
+		body, err := io.ReadAll(request.Body)
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(body), "<test>"))
+	})
+}
+
 func TestWithRequestJSON(t *testing.T) {
 	type TestJSON struct {
 		Id int `json:"id"`
@@ -177,6 +1302,48 @@ func TestWithRequestJSON(t *testing.T) {
 	})
 }
 
+func TestWithRequestNDJSON(t *testing.T) {
+	t.Run("items being JSON serialized line by line and set in body", func(t *testing.T) {
+		request := New().POST(context.Background(), testURL)
+		err := request.Dry(WithRequestNDJSON([]any{
+			map[string]int{"id": 1},
+			map[string]int{"id": 2},
+		}))
+
+		assert.NoError(t, err)
+		body, err := io.ReadAll(request.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "{\"id\":1}\n{\"id\":2}\n", string(body))
+		assert.Equal(t, "application/x-ndjson", request.Header.Get("Content-Type"))
+	})
+}
+
+type fakeProtobuf struct {
+	data []byte
+}
+
+func (f *fakeProtobuf) Marshal() ([]byte, error) {
+	return f.data, nil
+}
+
+func (f *fakeProtobuf) Unmarshal(data []byte) error {
+	f.data = data
+	return nil
+}
+
+func TestWithRequestProtobuf(t *testing.T) {
+	t.Run("message being serialized and set in body", func(t *testing.T) {
+		request := New().POST(context.Background(), testURL)
+		err := request.Dry(WithRequestProtobuf(&fakeProtobuf{data: []byte{0x08, 0x96, 0x01}}))
+
+		assert.NoError(t, err)
+		body, err := io.ReadAll(request.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0x08, 0x96, 0x01}, body)
+		assert.Equal(t, "application/x-protobuf", request.Header.Get("Content-Type"))
+	})
+}
+
 func TestWithRequestFormURLEncoded(t *testing.T) {
 	t.Run("map being url encoded and set in body", func(t *testing.T) {
 		request := New().
@@ -194,6 +1361,39 @@ func TestWithRequestFormURLEncoded(t *testing.T) {
 	})
 }
 
+func TestWithRequestFormStruct(t *testing.T) {
+	type TestForm struct {
+		Name     string   `form:"name"`
+		Age      int      `form:"age,omitempty"`
+		Tags     []string `form:"tag"`
+		Nickname *string  `form:"nickname,omitempty"`
+		Secret   string   `form:"-"`
+		Default  bool
+		internal string
+	}
+
+	t.Run("struct being url encoded and set in body", func(t *testing.T) {
+		request := New().POST(context.Background(), testURL)
+		err := request.Dry(WithRequestFormStruct(&TestForm{
+			Name:     "github",
+			Tags:     []string{"a", "b"},
+			Secret:   "hidden",
+			Default:  true,
+			internal: "hidden",
+		}))
+
+		assert.NoError(t, err)
+		body, err := io.ReadAll(request.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "Default=true&name=github&tag=a&tag=b", string(body))
+		assert.Equal(t, "application/x-www-form-urlencoded", request.Header.Get("Content-Type"))
+	})
+	t.Run("non-struct returns error", func(t *testing.T) {
+		request := New().POST(context.Background(), testURL)
+		assert.Error(t, request.Dry(WithRequestFormStruct("invalid")))
+	})
+}
+
 func TestWithRequestFormData(t *testing.T) {
 	t.Run("map being form data encoded and set in body", func(t *testing.T) {
 		request := New().
@@ -215,6 +1415,142 @@ func TestWithRequestFormData(t *testing.T) {
 	})
 }
 
+func TestWithRequestFormDataAny(t *testing.T) {
+	t.Run("mixed values being form data encoded and set in body", func(t *testing.T) {
+		request := New().
+			POST(context.Background(), testURL)
+
+		err := request.Dry(WithRequestFormDataAny(map[string]any{
+			"string": "value",
+			"int":    123,
+			"bytes":  []byte("raw"),
+			"reader": strings.NewReader("streamed"),
+		}))
+
+		assert.NoError(t, err)
+		_, param, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+		assert.NoError(t, err)
+		reader := multipart.NewReader(request.Body, param["boundary"])
+		form, err := reader.ReadForm(1000)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"value"}, form.Value["string"])
+		assert.Equal(t, []string{"123"}, form.Value["int"])
+		assert.Equal(t, []string{"raw"}, form.Value["bytes"])
+		assert.Equal(t, []string{"streamed"}, form.Value["reader"])
+	})
+}
+
+func TestWithRequestMultipartStream(t *testing.T) {
+	t.Run("large part is streamed without buffering", func(t *testing.T) {
+		const size = 64 << 20
+		var received int64
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reader, err := r.MultipartReader()
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			part, err := reader.NextPart()
+			if err != nil || part.FormName() != "file" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			received, _ = io.Copy(io.Discard, part)
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+
+		counter := &countingWriter{}
+		response := New().POST(context.Background(), server.URL).Do(
+			WithRequestMultipartStream(func(w *multipart.Writer) error {
+				part, err := w.CreateFormFile("file", "large.bin")
+				if err != nil {
+					return err
+				}
+
+				_, err = io.Copy(io.MultiWriter(part, counter), io.LimitReader(zeroReader{}, size))
+				return err
+			}),
+		)
+
+		runtime.ReadMemStats(&after)
+		assert.NoError(t, response.Err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, int64(size), counter.n)
+		assert.Equal(t, int64(size), received)
+		assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(size/4))
+	})
+}
+
+// countingWriter counts the bytes written to it.
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// zeroReader is an endless reader of zero bytes.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestWithRequestMultipartJSON(t *testing.T) {
+	t.Run("JSON part and file part are set in body", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "report.csv")
+		assert.NoError(t, os.WriteFile(filePath, []byte("a,b"), 0o600))
+
+		request := New().POST(context.Background(), testURL)
+		err := request.Dry(WithRequestMultipartJSON("meta", map[string]string{"title": "report"}, "file", filePath))
+		assert.NoError(t, err)
+
+		_, param, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+		assert.NoError(t, err)
+		reader := multipart.NewReader(request.Body, param["boundary"])
+
+		part, err := reader.NextPart()
+		assert.NoError(t, err)
+		assert.Equal(t, "meta", part.FormName())
+		assert.Equal(t, "application/json", part.Header.Get("Content-Type"))
+		meta := map[string]string{}
+		assert.NoError(t, json.NewDecoder(part).Decode(&meta))
+		assert.Equal(t, "report", meta["title"])
+
+		part, err = reader.NextPart()
+		assert.NoError(t, err)
+		assert.Equal(t, "file", part.FormName())
+		assert.Equal(t, "report.csv", part.FileName())
+		content, _ := io.ReadAll(part)
+		assert.Equal(t, "a,b", string(content))
+	})
+	t.Run("quotes and backslashes in the JSON field are escaped", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "report.csv")
+		assert.NoError(t, os.WriteFile(filePath, []byte("a,b"), 0o600))
+
+		request := New().POST(context.Background(), testURL)
+		err := request.Dry(WithRequestMultipartJSON(`me"ta\`, map[string]string{}, "file", filePath))
+		assert.NoError(t, err)
+
+		_, param, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+		assert.NoError(t, err)
+		part, err := multipart.NewReader(request.Body, param["boundary"]).NextPart()
+		assert.NoError(t, err)
+		assert.Equal(t, `me"ta\`, part.FormName())
+	})
+}
+
 func TestWithRequestAuthorizationBasic(t *testing.T) {
 	t.Run("credentials being base64 encoded and set in header", func(t *testing.T) {
 		request := New().POST(context.Background(), testURL)
@@ -225,6 +1561,27 @@ func TestWithRequestAuthorizationBasic(t *testing.T) {
 	})
 }
 
+func TestWithRequestAuthorizationBasicFunc(t *testing.T) {
+	t.Run("credentials from callback are encoded and set in header", func(t *testing.T) {
+		request := New().POST(context.Background(), testURL)
+		err := request.Dry(WithRequestAuthorizationBasicFunc(func(ctx context.Context) (string, string, error) {
+			return "123", "321", nil
+		}))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Basic MTIzOjMyMQ==", request.Header.Get("Authorization"))
+	})
+	t.Run("callback error is returned", func(t *testing.T) {
+		request := New().POST(context.Background(), testURL)
+		err := request.Dry(WithRequestAuthorizationBasicFunc(func(ctx context.Context) (string, string, error) {
+			return "", "", fmt.Errorf("vault unavailable")
+		}))
+
+		assert.EqualError(t, err, "vault unavailable")
+		assert.Empty(t, request.Header.Get("Authorization"))
+	})
+}
+
 func TestWithRequestAuthorizationBearer(t *testing.T) {
 	t.Run("value from callback is set in header", func(t *testing.T) {
 		request := New().POST(context.Background(), testURL)
@@ -246,3 +1603,156 @@ func TestWithRequestHeader(t *testing.T) {
 		assert.Equal(t, "1", request.Header.Get("X-TEST"))
 	})
 }
+
+func TestWithRequestHeaderFunc(t *testing.T) {
+	t.Run("header is computed from the built request", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Header.Get("X-Path")))
+		}))
+		defer server.Close()
+
+		var path string
+		response := New(WithBaseURL(server.URL)).GET(context.Background(), "users", "42").Do(
+			WithRequestHeaderFunc("X-Path", func(request *Request) (string, error) {
+				return request.URL.Path, nil
+			}),
+		)
+
+		assert.NoError(t, response.Handle(WithResponseBody(&path, func(data []byte, v any) error {
+			*v.(*string) = string(data)
+			return nil
+		})))
+		assert.Equal(t, "/users/42", path)
+	})
+	t.Run("header is set on each repeated request", func(t *testing.T) {
+		received := make(chan string, 5)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received <- r.Header.Get("X-Path")
+		}))
+		defer server.Close()
+
+		request := New(WithBaseURL(server.URL)).GET(context.Background(), "a")
+		assert.NoError(t, request.Dry(WithRequestHeaderFunc("X-Path", func(request *Request) (string, error) {
+			return request.URL.Path, nil
+		})))
+
+		for _, response := range request.Repeat(5, 5) {
+			assert.NoError(t, response.Err)
+		}
+
+		close(received)
+		assert.Len(t, received, 5)
+		for path := range received {
+			assert.Equal(t, "/a", path)
+		}
+		assert.Empty(t, request.Header.Get("X-Path"))
+	})
+	t.Run("error from function prevents sending", func(t *testing.T) {
+		var sent atomic.Bool
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sent.Store(true)
+		}))
+		defer server.Close()
+
+		response := New().GET(context.Background(), server.URL).Do(
+			WithRequestHeaderFunc("X-Signature", func(request *Request) (string, error) {
+				return "", fmt.Errorf("no key")
+			}),
+		)
+
+		assert.ErrorContains(t, response.Err, "no key")
+		assert.False(t, sent.Load())
+	})
+}
+
+func TestWithRequestHeaderFromContext(t *testing.T) {
+	type traceKey struct{}
+
+	t.Run("header is set from context value", func(t *testing.T) {
+		ctx := context.WithValue(context.Background(), traceKey{}, "abc-123")
+		request := New().GET(ctx, testURL)
+		err := request.Dry(WithRequestHeaderFromContext("X-Trace-Id", traceKey{}))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "abc-123", request.Header.Get("X-Trace-Id"))
+	})
+	t.Run("header is skipped when value is absent", func(t *testing.T) {
+		request := New().GET(context.Background(), testURL)
+		err := request.Dry(WithRequestHeaderFromContext("X-Trace-Id", traceKey{}))
+
+		assert.NoError(t, err)
+		assert.NotContains(t, request.Header, "X-Trace-Id")
+	})
+}
+
+func TestWithRequestPropagateTrace(t *testing.T) {
+	t.Run("trace context is set in headers", func(t *testing.T) {
+		request := New().GET(context.Background(), testURL)
+		err := request.Dry(WithRequestPropagateTrace(func(ctx context.Context) (string, string) {
+			return "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "vendor=value"
+		}))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", request.Header.Get("traceparent"))
+		assert.Equal(t, "vendor=value", request.Header.Get("tracestate"))
+	})
+	t.Run("empty trace context is skipped", func(t *testing.T) {
+		request := New().GET(context.Background(), testURL)
+		err := request.Dry(WithRequestPropagateTrace(func(ctx context.Context) (string, string) {
+			return "", ""
+		}))
+
+		assert.NoError(t, err)
+		assert.Empty(t, request.Header)
+	})
+}
+
+func TestWithRequestSOAPAction(t *testing.T) {
+	t.Run("quoted action is set in header", func(t *testing.T) {
+		request := New().POST(context.Background(), testURL)
+		err := request.Dry(WithRequestSOAPAction("http://tempuri.org/GetUser"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, `"http://tempuri.org/GetUser"`, request.Header.Get("SOAPAction"))
+	})
+}
+
+func TestWithRequestExpectGzip(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gzip" && r.Header.Get("Accept-Encoding") == "gzip" {
+			w.Header().Set("Content-Encoding", "gzip")
+			writer := gzip.NewWriter(w)
+			writer.Write([]byte("compressed"))
+			writer.Close()
+			return
+		}
+
+		w.Write([]byte("plain"))
+	}))
+	defer server.Close()
+
+	t.Run("gzip-encoded response passes", func(t *testing.T) {
+		response := New().GET(context.Background(), server.URL, "gzip").Do(WithRequestExpectGzip())
+
+		assert.NoError(t, response.Err)
+		assert.Equal(t, "gzip", response.Header.Get("Content-Encoding"))
+	})
+	t.Run("non-gzip response fails", func(t *testing.T) {
+		response := New().GET(context.Background(), server.URL, "plain").Do(WithRequestExpectGzip())
+
+		assert.EqualError(t, response.Err, "expected gzip-encoded response, received Content-Encoding ''")
+	})
+}
+
+func TestWithRequestCacheControl(t *testing.T) {
+	t.Run("directives are joined in header", func(t *testing.T) {
+		request := New().GET(context.Background(), testURL)
+		err := request.Dry(
+			WithRequestCacheControl("no-store"),
+			WithRequestCacheControl("no-cache", "max-age=60"),
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"no-cache, max-age=60"}, request.Header.Values("Cache-Control"))
+	})
+}
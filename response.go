@@ -1,15 +1,47 @@
 package requester
 
 import (
+	"bufio"
 	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
+// ErrBodyTooLarge is returned when the response body exceeds the limit given to WithResponseLimit.
+var ErrBodyTooLarge = errors.New("response body too large")
+
+var hopByHopHeaders = map[string]bool{
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+}
+
 // ResponseOption is a callback signature for modifying response options.
 type ResponseOption func(request *Response) error
 
@@ -17,6 +49,11 @@ type ResponseOption func(request *Response) error
 type Response struct {
 	*http.Response
 	Err error
+
+	// Duration is the time it took to receive the response headers, including retries.
+	Duration time.Duration
+
+	liftTimeout func()
 }
 
 // Handle executes the response handling options.
@@ -26,16 +63,76 @@ func (r *Response) Handle(opts ...ResponseOption) error {
 		return r.Err
 	}
 
-	var err error
+	errs := []error{}
 	for _, o := range opts {
-		err = errors.Join(r.Err, o(r))
+		errs = append(errs, o(r))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Unwrap returns the error associated with the response.
+func (r *Response) Unwrap() error {
+	return r.Err
+}
+
+// ConditionalNext makes the given request conditional on the response by copying the ETag
+// and Last-Modified headers of the response into the If-None-Match and If-Modified-Since
+// headers of the request.
+func (r *Response) ConditionalNext(request *Request) {
+	if request.Request == nil {
+		return
+	}
+
+	if etag := r.HeaderValues("ETag"); len(etag) > 0 {
+		request.Header.Set("If-None-Match", etag[0])
+	}
+
+	if lastModified := r.HeaderValues("Last-Modified"); len(lastModified) > 0 {
+		request.Header.Set("If-Modified-Since", lastModified[0])
 	}
+}
+
+// HeaderValues returns all values of the response header with the given key. The key is
+// case-insensitive. It returns nil if the response or its headers are missing.
+func (r *Response) HeaderValues(key string) []string {
+	if r == nil || r.Response == nil {
+		return nil
+	}
+
+	return r.Header.Values(key)
+}
+
+// maxStatusErrorBody is the number of body bytes included in the message of a StatusError.
+const maxStatusErrorBody = 1024
+
+// StatusError is returned by WithResponseStatusCodeAssertion when the response has an unexpected
+// status code. It holds the status code and the body of the response.
+type StatusError struct {
+	Code int
+	Body []byte
 
-	return err
+	expected []int
+}
+
+// Error returns the response body, or a description of the status code mismatch if the body is empty.
+// Bodies longer than maxStatusErrorBody bytes are truncated.
+func (e *StatusError) Error() string {
+	if len(e.Body) > maxStatusErrorBody {
+		return fmt.Sprintf("%s... (%d bytes truncated)", e.Body[:maxStatusErrorBody], len(e.Body)-maxStatusErrorBody)
+	} else if len(e.Body) > 0 {
+		return string(e.Body)
+	}
+
+	if len(e.expected) == 0 {
+		return fmt.Sprintf("unexpected status code '%d'", e.Code)
+	}
+
+	return fmt.Sprintf("expected status code(s) '%v', received '%d'", e.expected, e.Code)
 }
 
 // WithResponseStatusCodeAssertion checks if the response status code matches any of the specified codes.
-// If it does, it returns nil. Otherwise, it provides an error message.
+// If it does, it returns nil. Otherwise, it returns a *StatusError.
 func WithResponseStatusCodeAssertion(statusCodes ...int) ResponseOption {
 	return func(response *Response) error {
 		for _, code := range statusCodes {
@@ -44,6 +141,7 @@ func WithResponseStatusCodeAssertion(statusCodes ...int) ResponseOption {
 			}
 		}
 
+		statusError := &StatusError{Code: response.StatusCode, expected: statusCodes}
 		if response.Body != nil {
 			body, err := io.ReadAll(response.Body)
 			if err != nil {
@@ -51,12 +149,192 @@ func WithResponseStatusCodeAssertion(statusCodes ...int) ResponseOption {
 			}
 
 			response.Body = io.NopCloser(bytes.NewBuffer(body))
-			if len(body) > 0 {
-				return fmt.Errorf(string(body))
+			statusError.Body = body
+		}
+
+		return statusError
+	}
+}
+
+// WithResponseEmptyBody asserts that the response has no body. A nil body is considered empty.
+func WithResponseEmptyBody() ResponseOption {
+	return func(response *Response) error {
+		if response.Body == nil {
+			return nil
+		}
+
+		body, err := io.ReadAll(response.Body)
+		if err != nil {
+			return err
+		}
+
+		response.Body = io.NopCloser(bytes.NewBuffer(body))
+		if len(body) > 0 {
+			preview := body[:min(len(body), 64)]
+			return fmt.Errorf("expected empty body, received %d byte(s) '%s'", len(body), preview)
+		}
+
+		return nil
+	}
+}
+
+// WithResponseLimit asserts that the response body doesn't exceed limit bytes. At most limit + 1 bytes
+// are read, and ErrBodyTooLarge is returned when the limit is exceeded. Otherwise, the body remains
+// available for subsequent options.
+func WithResponseLimit(limit int64) ResponseOption {
+	return func(response *Response) error {
+		if response.Body == nil {
+			return nil
+		}
+
+		body, err := io.ReadAll(io.LimitReader(response.Body, limit+1))
+		if err != nil {
+			return err
+		}
+
+		if int64(len(body)) > limit {
+			return fmt.Errorf("%w: read %d bytes, exceeding the limit of %d bytes", ErrBodyTooLarge, len(body), limit)
+		}
+
+		response.Body = io.NopCloser(bytes.NewBuffer(body))
+		return nil
+	}
+}
+
+// WithResponseContentLengthRange asserts that the Content-Length header of the response is within the
+// given inclusive bounds. Responses without a Content-Length header pass.
+func WithResponseContentLengthRange(minLength, maxLength int64) ResponseOption {
+	return func(response *Response) error {
+		values := response.HeaderValues("Content-Length")
+		if len(values) == 0 {
+			return nil
+		}
+
+		length, err := strconv.ParseInt(values[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid Content-Length '%s': %w", values[0], err)
+		}
+
+		if length < minLength || length > maxLength {
+			return fmt.Errorf("expected Content-Length between %d and %d, received %d", minLength, maxLength, length)
+		}
+
+		return nil
+	}
+}
+
+// WithResponseHeaderExists asserts that the response has all the given headers, regardless of their values.
+// The returned error lists the missing headers.
+func WithResponseHeaderExists(keys ...string) ResponseOption {
+	return func(response *Response) error {
+		missing := []string{}
+		for _, key := range keys {
+			if len(response.HeaderValues(key)) == 0 {
+				missing = append(missing, key)
+			}
+		}
+
+		if len(missing) > 0 {
+			return fmt.Errorf("missing response header(s) '%s'", strings.Join(missing, "', '"))
+		}
+
+		return nil
+	}
+}
+
+// WithResponseHeaderAssertion asserts that the first value of the response header with the given key
+// equals the expected value.
+func WithResponseHeaderAssertion(key, expected string) ResponseOption {
+	return func(response *Response) error {
+		actual := ""
+		if values := response.HeaderValues(key); len(values) > 0 {
+			actual = values[0]
+		}
+
+		if actual != expected {
+			return fmt.Errorf("expected response header '%s' to be '%s', received '%s'", key, expected, actual)
+		}
+
+		return nil
+	}
+}
+
+// WithResponseHeaderPresent asserts that the response has the header with the given key, regardless of its value.
+func WithResponseHeaderPresent(key string) ResponseOption {
+	return WithResponseHeaderExists(key)
+}
+
+// WithResponseErrorMapper reads the response body and returns the error constructed by fn
+// when the response has a non-2xx status code. If status codes are provided, fn is invoked
+// for those status codes instead.
+func WithResponseErrorMapper(fn func(status int, body []byte) error, statuscodes ...int) ResponseOption {
+	return func(response *Response) error {
+		matches := len(statuscodes) == 0 && (response.StatusCode < 200 || response.StatusCode > 299)
+		for _, code := range statuscodes {
+			if code == response.StatusCode {
+				matches = true
+			}
+		}
+
+		if !matches {
+			return nil
+		}
+
+		var body []byte
+		if response.Body != nil {
+			var err error
+			if body, err = io.ReadAll(response.Body); err != nil {
+				return err
 			}
+
+			response.Body = io.NopCloser(bytes.NewBuffer(body))
+		}
+
+		return fn(response.StatusCode, body)
+	}
+}
+
+// WithResponseLines invokes fn for each line of the response body as it is streamed.
+// Reading stops at the end of the body or when fn returns an error. It will only read the body
+// if the response has one of the provided status codes.
+// If the list of status codes is empty, it will read the body for all status codes.
+func WithResponseLines(fn func(line string) error, statuscodes ...int) ResponseOption {
+	return WithResponseLinesSize(bufio.MaxScanTokenSize, fn, statuscodes...)
+}
+
+// WithResponseLinesSize is like WithResponseLines, but allows lines up to maxLineSize bytes.
+func WithResponseLinesSize(maxLineSize int, fn func(line string) error, statuscodes ...int) ResponseOption {
+	return func(response *Response) error {
+		if response.Body == nil || !matchStatusCode(response.StatusCode, statuscodes) {
+			return nil
+		}
+
+		return scan(response.Body, bufio.ScanLines, maxLineSize, func(token []byte) error {
+			return fn(string(token))
+		})
+	}
+}
+
+// WithResponseFramedReader invokes fn for each frame of the response body as it is streamed, where the
+// frames are delimited by the given split function. Reading stops at the end of the body or when fn
+// returns an error. The frame passed to fn may be overwritten by subsequent reads. It will only read
+// the body if the response has one of the provided status codes.
+// If the list of status codes is empty, it will read the body for all status codes.
+func WithResponseFramedReader(split bufio.SplitFunc, fn func(frame []byte) error, statuscodes ...int) ResponseOption {
+	return func(response *Response) error {
+		if response.Body == nil || !matchStatusCode(response.StatusCode, statuscodes) {
+			return nil
 		}
 
-		return fmt.Errorf("expected status code(s) '%v', received '%d'", statusCodes, response.StatusCode)
+		return scan(response.Body, split, bufio.MaxScanTokenSize, fn)
+	}
+}
+
+// WithResponseStatusErrors returns the error mapped to the status code of the response.
+// If the status code isn't mapped, it returns nil.
+func WithResponseStatusErrors(statusErrors map[int]error) ResponseOption {
+	return func(response *Response) error {
+		return statusErrors[response.StatusCode]
 	}
 }
 
@@ -70,6 +348,107 @@ func WithResponseJSON[T any](object *T, statuscodes ...int) ResponseOption {
 	}
 }
 
+// WithResponseJSONList unmarshals a top-level JSON array in the response body to the given slice.
+// It will only attempt to deserialize the payload if the response has one of the provided status codes.
+// If the list of status codes is empty, it will attempt to deserialize for all status codes.
+func WithResponseJSONList[T any](list *[]T, statuscodes ...int) ResponseOption {
+	return WithResponseJSON(list, statuscodes...)
+}
+
+// WithResponseJSONUseNumber unmarshals the JSON response body to an object like WithResponseJSON,
+// but decodes numbers into interface values as json.Number instead of float64 to preserve precision.
+func WithResponseJSONUseNumber[T any](object *T, statuscodes ...int) ResponseOption {
+	return func(response *Response) error {
+		return WithResponseBody(object, func(data []byte, v any) error {
+			decoder := json.NewDecoder(bytes.NewReader(data))
+			decoder.UseNumber()
+			return decoder.Decode(v)
+		}, statuscodes...)(response)
+	}
+}
+
+// WithResponseJSONContext decodes the JSON response body to an object while it is streamed. The decoding
+// is aborted when the given context is done, closing the body to interrupt a blocked read. The body is
+// consumed and not available to subsequent options.
+// It will only attempt to deserialize the payload if the response has one of the provided status codes.
+// If the list of status codes is empty, it will attempt to deserialize for all status codes.
+func WithResponseJSONContext[T any](ctx context.Context, object *T, statuscodes ...int) ResponseOption {
+	return func(response *Response) error {
+		if response.Body == nil || !matchStatusCode(response.StatusCode, statuscodes) {
+			return nil
+		}
+
+		reader, stop := readContext(ctx, response.Body)
+		defer stop()
+
+		err := json.NewDecoder(reader).Decode(object)
+		if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+			return ctxErr
+		}
+
+		return err
+	}
+}
+
+// WithResponseJSONToChannel streams the top-level JSON array of the response body, decoding each element
+// and sending it to the channel. The channel is owned by the caller and isn't closed. Decoding and sending
+// are aborted when the given context is done, closing the body to interrupt a blocked read. The body is
+// consumed and not available to subsequent options.
+// It will only attempt to deserialize the payload if the response has one of the provided status codes.
+// If the list of status codes is empty, it will attempt to deserialize for all status codes.
+func WithResponseJSONToChannel[T any](ctx context.Context, ch chan<- T, statuscodes ...int) ResponseOption {
+	return func(response *Response) error {
+		if response.Body == nil || !matchStatusCode(response.StatusCode, statuscodes) {
+			return nil
+		}
+
+		reader, stop := readContext(ctx, response.Body)
+		defer stop()
+
+		decoder := json.NewDecoder(reader)
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		if delim, ok := token.(json.Delim); !ok || delim != '[' {
+			return fmt.Errorf("expected a JSON array, received '%v'", token)
+		}
+
+		for decoder.More() {
+			var element T
+			if err := decoder.Decode(&element); err != nil {
+				return err
+			}
+
+			select {
+			case ch <- element:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		_, err = decoder.Token()
+		return err
+	}
+}
+
+// WithResponseRequireField unmarshals the JSON response body to an object and returns an error if the
+// field returned by get has the zero value. The name of the field is used in the error message.
+func WithResponseRequireField[T any](object *T, get func(object *T) any, name string) ResponseOption {
+	return func(response *Response) error {
+		if err := WithResponseJSON(object)(response); err != nil {
+			return err
+		}
+
+		if value := reflect.ValueOf(get(object)); !value.IsValid() || value.IsZero() {
+			return fmt.Errorf("required field '%s' is missing or empty", name)
+		}
+
+		return nil
+	}
+}
+
 // WithResponseXML unmarshals the XML response body to an object.
 // The object parameter should be a pointer to the target type. It will
 // only attempt to deserialize the payload if the response has one of the provided status codes.
@@ -80,19 +459,88 @@ func WithResponseXML[T any](object *T, statuscodes ...int) ResponseOption {
 	}
 }
 
+// WithResponseFormURLEncoded parses the application/x-www-form-urlencoded response body to the map. It will
+// only attempt to deserialize the payload if the response has one of the provided status codes.
+// If the list of status codes is empty, it will attempt to deserialize for all status codes.
+func WithResponseFormURLEncoded(dst *map[string][]string, statuscodes ...int) ResponseOption {
+	return func(response *Response) error {
+		return WithResponseBody(dst, func(data []byte, v any) error {
+			values, err := url.ParseQuery(string(data))
+			if err != nil {
+				return err
+			}
+
+			*dst = values
+			return nil
+		}, statuscodes...)(response)
+	}
+}
+
+// WithResponseProtobuf unmarshals the protobuf response body to the message. It will
+// only attempt to deserialize the payload if the response has one of the provided status codes.
+// If the list of status codes is empty, it will attempt to deserialize for all status codes.
+func WithResponseProtobuf(message interface{ Unmarshal(data []byte) error }, statuscodes ...int) ResponseOption {
+	return func(response *Response) error {
+		return WithResponseBody(&message, func(data []byte, v any) error {
+			return message.Unmarshal(data)
+		}, statuscodes...)(response)
+	}
+}
+
+// WithResponseInto unmarshals the response body to an object based on the Content-Type of the response.
+// JSON, XML and YAML payloads are supported, and bodies encoded in the ISO-8859-1 charset are
+// transcoded to UTF-8 before they are unmarshaled. It will only attempt to deserialize the payload
+// if the response has one of the provided status codes.
+// If the list of status codes is empty, it will attempt to deserialize for all status codes.
+func WithResponseInto[T any](object *T, statuscodes ...int) ResponseOption {
+	return func(response *Response) error {
+		return WithResponseBody(object, func(data []byte, v any) error {
+			contentType := strings.Join(response.HeaderValues("Content-Type"), ", ")
+			mediatype, params, err := mime.ParseMediaType(contentType)
+			if err != nil {
+				return fmt.Errorf("unable to parse Content-Type '%s': %w", contentType, err)
+			}
+
+			var unmarshaler func(data []byte, v any) error
+			switch {
+			case mediatype == "application/json" || strings.HasSuffix(mediatype, "+json"):
+				unmarshaler = json.Unmarshal
+			case mediatype == "application/xml" || mediatype == "text/xml" || strings.HasSuffix(mediatype, "+xml"):
+				unmarshaler = xml.Unmarshal
+			case mediatype == "application/yaml" || mediatype == "application/x-yaml" || mediatype == "text/yaml" || strings.HasSuffix(mediatype, "+yaml"):
+				unmarshaler = yaml.Unmarshal
+			default:
+				return fmt.Errorf("unsupported Content-Type '%s'", mediatype)
+			}
+
+			if data, err = decodeCharset(data, params["charset"]); err != nil {
+				return err
+			}
+
+			return unmarshaler(data, v)
+		}, statuscodes...)(response)
+	}
+}
+
 // WithUnmarshalXML unmarshals the response body to an object using the given unmarshaler.
 // The object parameter should be a pointer to the target type. It will
 // only attempt to deserialize the payload if the response has one of the provided status codes.
 // If the list of status codes is empty, it will attempt to deserialize for all status codes.
+// Responses with status code 204 or 304, or an empty body, are not deserialized. Decode errors include
+// the Content-Type and the first 200 bytes of the body.
 func WithResponseBody[T any](object *T, unmarshaler func(data []byte, v any) error, statuscodes ...int) ResponseOption {
 	return func(response *Response) (err error) {
 		defer func() {
 			if p := recover(); p != nil {
-				err = fmt.Errorf(fmt.Sprint(p))
+				err = fmt.Errorf("%v", p)
 			}
 		}()
 
 		deserialize := func() error {
+			if response.StatusCode == http.StatusNoContent || response.StatusCode == http.StatusNotModified {
+				return nil
+			}
+
 			if response.Body != nil {
 				body, err := io.ReadAll(response.Body)
 				if err != nil {
@@ -100,7 +548,14 @@ func WithResponseBody[T any](object *T, unmarshaler func(data []byte, v any) err
 				}
 
 				response.Body = io.NopCloser(bytes.NewBuffer(body))
-				return unmarshaler(body, object)
+				if len(body) == 0 {
+					return nil
+				}
+
+				if err := unmarshaler(body, object); err != nil {
+					contentType := strings.Join(response.HeaderValues("Content-Type"), ", ")
+					return fmt.Errorf("unable to decode response body (Content-Type '%s', body '%s'): %w", contentType, body[:min(len(body), 200)], err)
+				}
 			}
 
 			return nil
@@ -119,3 +574,689 @@ func WithResponseBody[T any](object *T, unmarshaler func(data []byte, v any) err
 		return nil
 	}
 }
+
+// SOAPFault is a SOAP 1.1 Fault element. It implements the error interface.
+type SOAPFault struct {
+	Code   string `xml:"faultcode"`
+	String string `xml:"faultstring"`
+	Actor  string `xml:"faultactor"`
+	Detail string `xml:"detail"`
+}
+
+// Error returns the fault code and fault string of the SOAP fault.
+func (f *SOAPFault) Error() string {
+	return fmt.Sprintf("soap fault '%s': %s", f.Code, f.String)
+}
+
+// WithResponseSOAPFault parses the response body for a SOAP Fault element, regardless of the status
+// code. If a fault is present, it is decoded into dst and returned as the error. The body remains
+// available for subsequent options.
+func WithResponseSOAPFault(dst *SOAPFault) ResponseOption {
+	return func(response *Response) error {
+		if response.Body == nil {
+			return nil
+		}
+
+		body, err := io.ReadAll(response.Body)
+		if err != nil {
+			return err
+		}
+
+		response.Body = io.NopCloser(bytes.NewBuffer(body))
+		if dst == nil {
+			dst = &SOAPFault{}
+		}
+
+		decoder := xml.NewDecoder(bytes.NewReader(body))
+		for {
+			token, err := decoder.Token()
+			if err == io.EOF {
+				return nil
+			}
+
+			if err != nil {
+				return fmt.Errorf("unable to parse SOAP body: %w", err)
+			}
+
+			if start, ok := token.(xml.StartElement); ok && start.Name.Local == "Fault" {
+				if err := decoder.DecodeElement(dst, &start); err != nil {
+					return fmt.Errorf("unable to parse SOAP fault: %w", err)
+				}
+
+				return dst
+			}
+		}
+	}
+}
+
+// WithResponseSaveOrError streams the response body to the file at the given path if the response has one
+// of the success status codes, or a 2xx status code if none are given. Otherwise, no file is created and
+// the body is returned as a *StatusError.
+func WithResponseSaveOrError(path string, successCodes ...int) ResponseOption {
+	return func(response *Response) error {
+		success := len(successCodes) == 0 && response.StatusCode >= 200 && response.StatusCode <= 299
+		if !success && !slices.Contains(successCodes, response.StatusCode) {
+			statusError := &StatusError{Code: response.StatusCode, expected: successCodes}
+			if response.Body != nil {
+				body, err := io.ReadAll(response.Body)
+				if err != nil {
+					return err
+				}
+
+				response.Body = io.NopCloser(bytes.NewBuffer(body))
+				statusError.Body = body
+			}
+
+			return statusError
+		}
+
+		return WithResponseFile(path)(response)
+	}
+}
+
+// WithResponseFile streams the response body to the file at the given path, creating or truncating it.
+// The body isn't buffered in memory, so it is consumed and not available to subsequent options.
+// It will only write the file if the response has one of the provided status codes.
+// If the list of status codes is empty, it will write the file for all status codes.
+func WithResponseFile(path string, statuscodes ...int) ResponseOption {
+	return func(response *Response) error {
+		if !matchStatusCode(response.StatusCode, statuscodes) {
+			return nil
+		}
+
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		if response.Body != nil {
+			if _, err = io.Copy(file, response.Body); err != nil {
+				return err
+			}
+		}
+
+		return file.Close()
+	}
+}
+
+// WithResponseSaveCookies stores the cookies set by the response in the given cookie jar.
+// The cookies are associated with the URL of the request that produced the response.
+func WithResponseSaveCookies(jar http.CookieJar) ResponseOption {
+	return func(response *Response) error {
+		if response.Request == nil || response.Request.URL == nil {
+			return errors.New("response has no request URL to associate cookies with")
+		}
+
+		jar.SetCookies(response.Request.URL, response.Cookies())
+		return nil
+	}
+}
+
+func mergePatch(document, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	documentObject, ok := document.(map[string]any)
+	if !ok {
+		documentObject = map[string]any{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(documentObject, key)
+		} else {
+			documentObject[key] = mergePatch(documentObject[key], value)
+		}
+	}
+
+	return documentObject
+}
+
+func jsonDiff(expected, actual any, path string) (diff []string) {
+	location := path
+	if location == "" {
+		location = "/"
+	}
+
+	switch e := expected.(type) {
+	case map[string]any:
+		a, ok := actual.(map[string]any)
+		if !ok {
+			break
+		}
+
+		keys := make([]string, 0, len(e)+len(a))
+		for key := range e {
+			keys = append(keys, key)
+		}
+
+		for key := range a {
+			if _, ok := e[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			ev, eok := e[key]
+			av, aok := a[key]
+			switch {
+			case !aok:
+				diff = append(diff, fmt.Sprintf("%s/%s: missing, expected %s", path, key, jsonString(ev)))
+			case !eok:
+				diff = append(diff, fmt.Sprintf("%s/%s: unexpected %s", path, key, jsonString(av)))
+			default:
+				diff = append(diff, jsonDiff(ev, av, path+"/"+key)...)
+			}
+		}
+
+		return diff
+	case []any:
+		a, ok := actual.([]any)
+		if !ok || len(a) != len(e) {
+			break
+		}
+
+		for i := range e {
+			diff = append(diff, jsonDiff(e[i], a[i], fmt.Sprintf("%s/%d", path, i))...)
+		}
+
+		return diff
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		diff = append(diff, fmt.Sprintf("%s: expected %s, received %s", location, jsonString(expected), jsonString(actual)))
+	}
+
+	return diff
+}
+
+func jsonString(value any) string {
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+func scan(reader io.Reader, split bufio.SplitFunc, maxTokenSize int, fn func(token []byte) error) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, min(maxTokenSize, bufio.MaxScanTokenSize)), maxTokenSize)
+	scanner.Split(split)
+	for scanner.Scan() {
+		if err := fn(scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+func matchStatusCode(statusCode int, statuscodes []int) bool {
+	if len(statuscodes) == 0 {
+		return true
+	}
+
+	for _, code := range statuscodes {
+		if code == statusCode {
+			return true
+		}
+	}
+
+	return false
+}
+
+func decodeCharset(data []byte, charset string) ([]byte, error) {
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "utf8", "us-ascii":
+		return data, nil
+	case "iso-8859-1", "latin1", "latin-1":
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+
+		return []byte(string(runes)), nil
+	default:
+		return nil, fmt.Errorf("unsupported charset '%s'", charset)
+	}
+}
+
+// WithResponseCookieValue stores the value of the named cookie set by the response in dst.
+// If the cookie is absent, dst is set to the empty string.
+func WithResponseCookieValue(name string, dst *string) ResponseOption {
+	return func(response *Response) error {
+		*dst = ""
+		for _, cookie := range response.Cookies() {
+			if cookie.Name == name {
+				*dst = cookie.Value
+				return nil
+			}
+		}
+
+		return nil
+	}
+}
+
+// WithResponseFinalURL stores the URL of the final request in dst, which differs from the
+// requested URL when redirects were followed.
+func WithResponseFinalURL(dst *url.URL) ResponseOption {
+	return func(response *Response) error {
+		if response.Request == nil || response.Request.URL == nil {
+			return errors.New("response has no request URL")
+		}
+
+		*dst = *response.Request.URL
+		return nil
+	}
+}
+
+// WithResponseProxyTo forwards the response to the given response writer by writing the status
+// code and streaming the body. If copyHeaders is true, the response headers are forwarded as well,
+// except for hop-by-hop headers.
+func WithResponseProxyTo(w http.ResponseWriter, copyHeaders bool) ResponseOption {
+	return func(response *Response) error {
+		if copyHeaders {
+			for key, values := range response.Header {
+				if hopByHopHeaders[key] {
+					continue
+				}
+
+				for _, value := range values {
+					w.Header().Add(key, value)
+				}
+			}
+		}
+
+		w.WriteHeader(response.StatusCode)
+		if response.Body == nil {
+			return nil
+		}
+
+		_, err := io.Copy(w, response.Body)
+		return err
+	}
+}
+
+// WithResponseByteCount wraps the response body, so that dst holds the number of body bytes read
+// by the subsequent options. It must be provided before the options consuming the body.
+func WithResponseByteCount(dst *int64) ResponseOption {
+	return func(response *Response) error {
+		*dst = 0
+		if response.Body != nil {
+			response.Body = &countReadCloser{ReadCloser: response.Body, count: dst}
+		}
+
+		return nil
+	}
+}
+
+// WithResponseProgress wraps the response body, so that onProgress is called with the number of body bytes
+// read so far and the Content-Length of the response, or -1 when it is unknown. It only wraps the body if
+// the response has one of the provided status codes, or for all status codes if the list is empty. It must
+// be provided before the options consuming the body.
+func WithResponseProgress(onProgress func(read, total int64), statuscodes ...int) ResponseOption {
+	return func(response *Response) error {
+		if response.Body == nil || !matchStatusCode(response.StatusCode, statuscodes) {
+			return nil
+		}
+
+		response.Body = struct {
+			io.Reader
+			io.Closer
+		}{
+			Reader: &progressReader{reader: response.Body, total: max(response.ContentLength, -1), onProgress: onProgress},
+			Closer: response.Body,
+		}
+
+		return nil
+	}
+}
+
+// WithResponseReader hands the response body over to dst and replaces it with an empty body, so
+// subsequent options don't read it. The caller owns the reader and is responsible for closing it.
+func WithResponseReader(dst *io.ReadCloser) ResponseOption {
+	return func(response *Response) error {
+		*dst = response.Body
+		if *dst == nil {
+			*dst = http.NoBody
+		}
+
+		response.Body = http.NoBody
+		return nil
+	}
+}
+
+// WithResponseZlib decompresses the response body when the response has the zlib Content-Encoding.
+// It is WithResponseDecompress restricted to zlib, so it must be provided before the options
+// consuming the body.
+func WithResponseZlib() ResponseOption {
+	return func(response *Response) error {
+		encoding := strings.Join(response.HeaderValues("Content-Encoding"), ", ")
+		if !strings.EqualFold(strings.TrimSpace(encoding), "zlib") {
+			return nil
+		}
+
+		return WithResponseDecompress()(response)
+	}
+}
+
+// WithResponseDecompress decompresses the response body according to its Content-Encoding, which is
+// necessary when the transport doesn't decompress it, e.g. because the Accept-Encoding header was set
+// explicitly. The gzip, deflate and zlib encodings are supported, where deflate bodies may be either
+// zlib-wrapped or raw. Bodies without encoding, or with the identity encoding, are left untouched, and
+// an error is returned for other encodings. The body is decompressed while it is read, so the option
+// must be provided before the options consuming the body.
+func WithResponseDecompress() ResponseOption {
+	return func(response *Response) error {
+		encoding := strings.ToLower(strings.TrimSpace(strings.Join(response.HeaderValues("Content-Encoding"), ", ")))
+		if encoding == "" || encoding == "identity" || response.Body == nil {
+			return nil
+		}
+
+		var reader io.ReadCloser
+		switch encoding {
+		case "gzip", "x-gzip":
+			gzipReader, err := gzip.NewReader(response.Body)
+			if err != nil {
+				return fmt.Errorf("unable to decompress gzip body: %w", err)
+			}
+
+			reader = gzipReader
+		case "deflate", "zlib":
+			buffered := bufio.NewReader(response.Body)
+			header, _ := buffered.Peek(2)
+			if len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+				zlibReader, err := zlib.NewReader(buffered)
+				if err != nil {
+					return fmt.Errorf("unable to decompress %s body: %w", encoding, err)
+				}
+
+				reader = zlibReader
+			} else {
+				reader = flate.NewReader(buffered)
+			}
+		default:
+			return fmt.Errorf("unsupported Content-Encoding '%s'", encoding)
+		}
+
+		response.Body = struct {
+			io.Reader
+			io.Closer
+		}{
+			Reader: reader,
+			Closer: response.Body,
+		}
+		response.ContentLength = -1
+		response.Header.Del("Content-Encoding")
+		response.Header.Del("Content-Length")
+		response.Uncompressed = true
+		return nil
+	}
+}
+
+// WithResponseStripBOM removes a leading UTF-8 byte order mark from the response body.
+// It must be provided before the options deserializing the body.
+func WithResponseStripBOM() ResponseOption {
+	return func(response *Response) error {
+		if response.Body == nil {
+			return nil
+		}
+
+		body, err := io.ReadAll(response.Body)
+		if err != nil {
+			return err
+		}
+
+		response.Body = io.NopCloser(bytes.NewReader(bytes.TrimPrefix(body, []byte("\xef\xbb\xbf"))))
+		return nil
+	}
+}
+
+// WithResponseSample writes the first n bytes of the response body to the given writer without
+// buffering the rest of the body, which remains available for subsequent options.
+func WithResponseSample(w io.Writer, n int) ResponseOption {
+	return func(response *Response) error {
+		if response.Body == nil {
+			return nil
+		}
+
+		sample, err := io.ReadAll(io.LimitReader(response.Body, int64(n)))
+		if err != nil {
+			return err
+		}
+
+		response.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(sample), response.Body), response.Body}
+
+		_, err = w.Write(sample)
+		return err
+	}
+}
+
+// WithResponseHexDump writes a hex dump of up to maxBytes of the response body to the given writer.
+// The body remains available for subsequent options.
+func WithResponseHexDump(w io.Writer, maxBytes int) ResponseOption {
+	return func(response *Response) error {
+		if response.Body == nil {
+			return nil
+		}
+
+		body, err := io.ReadAll(response.Body)
+		if err != nil {
+			return err
+		}
+
+		response.Body = io.NopCloser(bytes.NewBuffer(body))
+		dumper := hex.Dumper(w)
+		if _, err = dumper.Write(body[:min(len(body), max(maxBytes, 0))]); err != nil {
+			return err
+		}
+
+		return dumper.Close()
+	}
+}
+
+// contextReader stops reading from the body when the context is done. It is created with readContext,
+// which closes the body when the context is done, so a blocked read is interrupted as well.
+type contextReader struct {
+	ctx  context.Context
+	body io.ReadCloser
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := c.body.Read(p)
+	if err != nil && c.ctx.Err() != nil {
+		return n, c.ctx.Err()
+	}
+
+	return n, err
+}
+
+// readContext returns a reader of the body which is aborted when the context is done, and a function
+// which stops watching the context.
+func readContext(ctx context.Context, body io.ReadCloser) (*contextReader, func() bool) {
+	stop := context.AfterFunc(ctx, func() { body.Close() })
+	return &contextReader{ctx: ctx, body: body}, stop
+}
+
+// WithResponseStreamKeepAlive aborts reading the response body when no bytes are received within the
+// given duration. The deadline is reset on every read, so slow but healthy streams aren't interrupted.
+// The timeout of the request is lifted, so it doesn't interrupt the stream either, while the request
+// context deadline still applies. It wraps the body and must be provided before the options consuming the body.
+func WithResponseStreamKeepAlive(perChunkTimeout time.Duration) ResponseOption {
+	return func(response *Response) error {
+		if response.Body != nil {
+			if response.liftTimeout != nil {
+				response.liftTimeout()
+			}
+
+			response.Body = &stallReadCloser{ReadCloser: response.Body, timeout: perChunkTimeout}
+		}
+
+		return nil
+	}
+}
+
+// stallReadCloser closes the underlying body when a read doesn't complete within the timeout.
+type stallReadCloser struct {
+	io.ReadCloser
+	timeout time.Duration
+	stalled atomic.Bool
+}
+
+func (s *stallReadCloser) Read(p []byte) (int, error) {
+	if s.stalled.Load() {
+		return 0, fmt.Errorf("response body stalled: no bytes received within %s", s.timeout)
+	}
+
+	timer := time.AfterFunc(s.timeout, func() {
+		s.stalled.Store(true)
+		s.ReadCloser.Close()
+	})
+
+	n, err := s.ReadCloser.Read(p)
+	if !timer.Stop() && s.stalled.Load() {
+		return n, fmt.Errorf("response body stalled: no bytes received within %s", s.timeout)
+	}
+
+	return n, err
+}
+
+// WithResponseJSONMergePatch applies the response body as a JSON merge patch (RFC 7386) to the target.
+// The target parameter should be a pointer to the object being patched.
+func WithResponseJSONMergePatch(target any) ResponseOption {
+	return func(response *Response) error {
+		value := reflect.ValueOf(target)
+		if value.Kind() != reflect.Pointer || value.IsNil() {
+			return fmt.Errorf("merge patch target must be a non-nil pointer, received %T", target)
+		}
+
+		if response.Body == nil {
+			return nil
+		}
+
+		body, err := io.ReadAll(response.Body)
+		if err != nil {
+			return err
+		}
+
+		response.Body = io.NopCloser(bytes.NewBuffer(body))
+
+		var patch, document any
+		if err = json.Unmarshal(body, &patch); err != nil {
+			return err
+		}
+
+		original, err := json.Marshal(target)
+		if err != nil {
+			return err
+		}
+
+		if err = json.Unmarshal(original, &document); err != nil {
+			return err
+		}
+
+		patched, err := json.Marshal(mergePatch(document, patch))
+		if err != nil {
+			return err
+		}
+
+		value.Elem().Set(reflect.Zero(value.Elem().Type()))
+		return json.Unmarshal(patched, target)
+	}
+}
+
+// WithResponseJSONSchema validates the JSON response body against the given JSON schema. The built-in
+// validator supports the type, enum, required, properties and items keywords, and returns an error for
+// schemas with other keywords; use WithResponseJSONSchemaValidator to plug in a complete implementation.
+func WithResponseJSONSchema(schema []byte) ResponseOption {
+	return WithResponseJSONSchemaValidator(basicSchemaValidator{}, schema)
+}
+
+// WithResponseJSONSchemaValidator validates the JSON response body against the given JSON schema
+// using the given validator.
+func WithResponseJSONSchemaValidator(validator JSONSchemaValidator, schema []byte) ResponseOption {
+	return func(response *Response) error {
+		var body []byte
+		if response.Body != nil {
+			var err error
+			if body, err = io.ReadAll(response.Body); err != nil {
+				return err
+			}
+
+			response.Body = io.NopCloser(bytes.NewBuffer(body))
+		}
+
+		if err := validator.Validate(schema, body); err != nil {
+			return fmt.Errorf("response body doesn't match JSON schema: %w", err)
+		}
+
+		return nil
+	}
+}
+
+// WithResponseSlowThreshold invokes onSlow with the duration of the request when it exceeded the given threshold.
+func WithResponseSlowThreshold(threshold time.Duration, onSlow func(elapsed time.Duration)) ResponseOption {
+	return func(response *Response) error {
+		if response.Duration > threshold {
+			onSlow(response.Duration)
+		}
+
+		return nil
+	}
+}
+
+// WithResponseJSONEquals asserts that the JSON response body is equal to the JSON representation of
+// the expected object, ignoring the order of object keys. The returned error lists the differences.
+func WithResponseJSONEquals(expected any) ResponseOption {
+	return func(response *Response) error {
+		var body []byte
+		if response.Body != nil {
+			var err error
+			if body, err = io.ReadAll(response.Body); err != nil {
+				return err
+			}
+
+			response.Body = io.NopCloser(bytes.NewBuffer(body))
+		}
+
+		var actual, want any
+		if err := json.Unmarshal(body, &actual); err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(expected)
+		if err != nil {
+			return err
+		}
+
+		if err = json.Unmarshal(data, &want); err != nil {
+			return err
+		}
+
+		if diff := jsonDiff(want, actual, ""); len(diff) > 0 {
+			return fmt.Errorf("JSON body mismatch:\n%s", strings.Join(diff, "\n"))
+		}
+
+		return nil
+	}
+}
+
+// countReadCloser adds the number of bytes read to count.
+type countReadCloser struct {
+	io.ReadCloser
+	count *int64
+}
+
+func (c *countReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	atomic.AddInt64(c.count, int64(n))
+	return n, err
+}
@@ -1,13 +1,28 @@
 package requester
 
 import (
+	"bufio"
 	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -27,6 +42,97 @@ func MoqResponse(opts ...func(response *Response)) *Response {
 	return response
 }
 
+func TestHandle(t *testing.T) {
+	t.Run("errors of all options are reported", func(t *testing.T) {
+		err := MoqResponse(func(response *Response) {
+			response.StatusCode = http.StatusBadRequest
+			response.Body = io.NopCloser(strings.NewReader("invalid request"))
+		}).Handle(
+			WithResponseStatusCodeAssertion(http.StatusOK),
+			WithResponseJSON(&map[string]any{}),
+		)
+
+		actual, ok := err.(interface {
+			Unwrap() []error
+		})
+
+		assert.True(t, ok)
+		assert.Len(t, actual.Unwrap(), 2)
+
+		var statusError *StatusError
+		assert.ErrorAs(t, err, &statusError)
+		assert.ErrorContains(t, err, "unable to decode response body")
+	})
+	t.Run("response error short-circuits the options", func(t *testing.T) {
+		called := false
+		err := MoqResponse(func(response *Response) {
+			response.Err = fmt.Errorf("connection refused")
+		}).Handle(func(response *Response) error {
+			called = true
+			return nil
+		})
+
+		assert.EqualError(t, err, "connection refused")
+		assert.False(t, called)
+	})
+}
+
+func TestUnwrap(t *testing.T) {
+	t.Run("error from timed out request is unwrapped", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}))
+		defer server.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+		defer cancel()
+
+		response := New().GET(ctx, server.URL).Do()
+		assert.True(t, errors.Is(response.Err, context.DeadlineExceeded))
+		assert.True(t, errors.Is(response.Unwrap(), context.DeadlineExceeded))
+	})
+}
+
+func TestHeaderValues(t *testing.T) {
+	t.Run("multi-valued header is retrieved case-insensitively", func(t *testing.T) {
+		response := MoqResponse(func(response *Response) {
+			response.Header = http.Header{"X-Forwarded-For": {"10.0.0.1", "10.0.0.2"}}
+		})
+
+		assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, response.HeaderValues("x-forwarded-for"))
+	})
+	t.Run("missing response and headers are nil-safe", func(t *testing.T) {
+		var response *Response
+		assert.Nil(t, response.HeaderValues("X-Test"))
+		assert.Nil(t, (&Response{}).HeaderValues("X-Test"))
+		assert.Nil(t, MoqResponse().HeaderValues("X-Test"))
+	})
+}
+
+func TestConditionalNext(t *testing.T) {
+	t.Run("ETag is carried into the follow-up request", func(t *testing.T) {
+		lastModified := time.Now().UTC().Format(http.TimeFormat)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("If-None-Match") == `"v1"` && r.Header.Get("If-Modified-Since") == lastModified {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Last-Modified", lastModified)
+		}))
+		defer server.Close()
+
+		client := New(WithBaseURL(server.URL))
+		response := client.GET(context.Background()).Do()
+		assert.NoError(t, response.Handle(WithResponseStatusCodeAssertion(http.StatusOK)))
+
+		request := client.GET(context.Background())
+		response.ConditionalNext(request)
+		assert.NoError(t, request.Do().Handle(WithResponseStatusCodeAssertion(http.StatusNotModified)))
+	})
+}
+
 func TestWithResponseStatusCodeAssertion(t *testing.T) {
 	t.Run("response and asserted HTTP code match", func(t *testing.T) {
 		assert.NoError(t, MoqResponse().Handle(WithResponseStatusCodeAssertion(http.StatusOK)))
@@ -39,6 +145,243 @@ func TestWithResponseStatusCodeAssertion(t *testing.T) {
 			response.Body = io.NopCloser(strings.NewReader("this is an error"))
 		}).Handle(WithResponseStatusCodeAssertion(http.StatusCreated)).Error(), "this is an error")
 	})
+	t.Run("body with format verbs is returned verbatim", func(t *testing.T) {
+		err := MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(strings.NewReader("quota exceeded: %d of 100%"))
+		}).Handle(WithResponseStatusCodeAssertion(http.StatusCreated))
+
+		assert.EqualError(t, err, "quota exceeded: %d of 100%")
+	})
+	t.Run("large body is truncated", func(t *testing.T) {
+		response := MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(strings.NewReader(strings.Repeat("x", 4096)))
+		})
+		err := response.Handle(WithResponseStatusCodeAssertion(http.StatusCreated))
+
+		assert.EqualError(t, err, strings.Repeat("x", 1024)+"... (3072 bytes truncated)")
+
+		var statusError *StatusError
+		assert.ErrorAs(t, err, &statusError)
+		assert.Len(t, statusError.Body, 4096)
+	})
+	t.Run("mismatch returns status error", func(t *testing.T) {
+		err := MoqResponse(func(response *Response) {
+			response.StatusCode = http.StatusBadRequest
+			response.Body = io.NopCloser(strings.NewReader(`{"error":"invalid"}`))
+		}).Handle(WithResponseStatusCodeAssertion(http.StatusOK))
+
+		var statusError *StatusError
+		assert.ErrorAs(t, err, &statusError)
+		assert.Equal(t, http.StatusBadRequest, statusError.Code)
+		assert.Equal(t, `{"error":"invalid"}`, string(statusError.Body))
+	})
+}
+
+func TestWithResponseEmptyBody(t *testing.T) {
+	t.Run("empty 204 passes", func(t *testing.T) {
+		assert.NoError(t, MoqResponse(func(response *Response) {
+			response.StatusCode = http.StatusNoContent
+			response.Body = http.NoBody
+		}).Handle(WithResponseEmptyBody()))
+	})
+	t.Run("nil body passes", func(t *testing.T) {
+		assert.NoError(t, MoqResponse().Handle(WithResponseEmptyBody()))
+	})
+	t.Run("200 with content fails", func(t *testing.T) {
+		response := MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(strings.NewReader("content"))
+		})
+
+		assert.EqualError(t, response.Handle(WithResponseEmptyBody()), "expected empty body, received 7 byte(s) 'content'")
+		body, _ := io.ReadAll(response.Body)
+		assert.Equal(t, "content", string(body))
+	})
+}
+
+func TestWithResponseLimit(t *testing.T) {
+	t.Run("body exceeding the limit returns ErrBodyTooLarge", func(t *testing.T) {
+		err := MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(strings.NewReader("0123456789"))
+		}).Handle(WithResponseLimit(5))
+
+		assert.True(t, errors.Is(err, ErrBodyTooLarge))
+		assert.EqualError(t, err, "response body too large: read 6 bytes, exceeding the limit of 5 bytes")
+	})
+	t.Run("body within the limit is kept", func(t *testing.T) {
+		response := MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(strings.NewReader("01234"))
+		})
+
+		assert.NoError(t, response.Handle(WithResponseLimit(5)))
+		body, _ := io.ReadAll(response.Body)
+		assert.Equal(t, "01234", string(body))
+	})
+}
+
+func TestWithResponseContentLengthRange(t *testing.T) {
+	moq := func(length string) *Response {
+		return MoqResponse(func(response *Response) {
+			response.Header = http.Header{"Content-Length": {length}}
+		})
+	}
+
+	t.Run("under range fails", func(t *testing.T) {
+		assert.EqualError(t, moq("10").Handle(WithResponseContentLengthRange(100, 1000)), "expected Content-Length between 100 and 1000, received 10")
+	})
+	t.Run("over range fails", func(t *testing.T) {
+		assert.EqualError(t, moq("10000").Handle(WithResponseContentLengthRange(100, 1000)), "expected Content-Length between 100 and 1000, received 10000")
+	})
+	t.Run("within range passes", func(t *testing.T) {
+		assert.NoError(t, moq("500").Handle(WithResponseContentLengthRange(100, 1000)))
+	})
+	t.Run("missing header passes", func(t *testing.T) {
+		assert.NoError(t, MoqResponse().Handle(WithResponseContentLengthRange(100, 1000)))
+	})
+}
+
+func TestWithResponseHeaderExists(t *testing.T) {
+	moq := MoqResponse(func(response *Response) {
+		response.Header = http.Header{}
+		response.Header.Set("X-Request-Id", "abc")
+		response.Header.Set("ETag", "")
+	})
+
+	t.Run("all headers present passes", func(t *testing.T) {
+		assert.NoError(t, moq.Handle(WithResponseHeaderExists("x-request-id", "ETag")))
+	})
+	t.Run("missing header fails with its name", func(t *testing.T) {
+		err := moq.Handle(WithResponseHeaderExists("X-Request-Id", "X-Trace-Id", "Location"))
+		assert.EqualError(t, err, "missing response header(s) 'X-Trace-Id', 'Location'")
+	})
+}
+
+func TestWithResponseHeaderAssertion(t *testing.T) {
+	moq := func(contentType string) *Response {
+		return MoqResponse(func(response *Response) {
+			response.Header = http.Header{}
+			if contentType != "" {
+				response.Header.Set("Content-Type", contentType)
+			}
+		})
+	}
+
+	t.Run("matching header passes", func(t *testing.T) {
+		assert.NoError(t, moq("application/json").Handle(WithResponseHeaderAssertion("Content-Type", "application/json")))
+	})
+	t.Run("mismatching header fails", func(t *testing.T) {
+		err := moq("text/html").Handle(WithResponseHeaderAssertion("Content-Type", "application/json"))
+		assert.EqualError(t, err, "expected response header 'Content-Type' to be 'application/json', received 'text/html'")
+	})
+	t.Run("omitted header fails", func(t *testing.T) {
+		err := moq("").Handle(WithResponseHeaderAssertion("Content-Type", "application/json"))
+		assert.EqualError(t, err, "expected response header 'Content-Type' to be 'application/json', received ''")
+	})
+	t.Run("present header passes", func(t *testing.T) {
+		assert.NoError(t, moq("text/html").Handle(WithResponseHeaderPresent("Content-Type")))
+	})
+	t.Run("omitted header is not present", func(t *testing.T) {
+		assert.EqualError(t, moq("").Handle(WithResponseHeaderPresent("Content-Type")), "missing response header(s) 'Content-Type'")
+	})
+}
+
+func TestWithResponseErrorMapper(t *testing.T) {
+	ErrNotFound := errors.New("not found")
+	mapper := func(status int, body []byte) error {
+		if status == http.StatusNotFound {
+			return fmt.Errorf("%w: %s", ErrNotFound, body)
+		}
+
+		return fmt.Errorf("unexpected status %d", status)
+	}
+
+	t.Run("404 is mapped to sentinel error", func(t *testing.T) {
+		err := MoqResponse(func(response *Response) {
+			response.StatusCode = http.StatusNotFound
+			response.Body = io.NopCloser(strings.NewReader("user"))
+		}).Handle(WithResponseErrorMapper(mapper))
+
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.Equal(t, "not found: user", err.Error())
+	})
+	t.Run("2xx is not mapped", func(t *testing.T) {
+		assert.NoError(t, MoqResponse().Handle(WithResponseErrorMapper(mapper)))
+	})
+	t.Run("configured status codes are mapped", func(t *testing.T) {
+		err := MoqResponse().Handle(WithResponseErrorMapper(mapper, http.StatusOK))
+		assert.EqualError(t, err, "unexpected status 200")
+	})
+}
+
+func TestWithResponseFramedReader(t *testing.T) {
+	lengthPrefixed := func(data []byte, atEOF bool) (int, []byte, error) {
+		if len(data) < 4 {
+			if atEOF && len(data) > 0 {
+				return 0, nil, io.ErrUnexpectedEOF
+			}
+
+			return 0, nil, nil
+		}
+
+		size := int(binary.BigEndian.Uint32(data[:4]))
+		if len(data) < 4+size {
+			if atEOF {
+				return 0, nil, io.ErrUnexpectedEOF
+			}
+
+			return 0, nil, nil
+		}
+
+		return 4 + size, data[4 : 4+size], nil
+	}
+
+	frame := func(message string) []byte {
+		return append(binary.BigEndian.AppendUint32(nil, uint32(len(message))), message...)
+	}
+
+	t.Run("length-prefixed frames are delivered", func(t *testing.T) {
+		frames := []string{}
+		err := MoqResponse(func(response *Response) {
+			body := append(append(frame("first"), frame("")...), frame("third message")...)
+			response.Body = io.NopCloser(bytes.NewReader(body))
+		}).Handle(WithResponseFramedReader(lengthPrefixed, func(frame []byte) error {
+			frames = append(frames, string(frame))
+			return nil
+		}))
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"first", "", "third message"}, frames)
+	})
+	t.Run("truncated frame returns error", func(t *testing.T) {
+		err := MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(bytes.NewReader(frame("first")[:6]))
+		}).Handle(WithResponseFramedReader(lengthPrefixed, func(frame []byte) error { return nil }))
+
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+}
+
+func TestWithResponseStatusErrors(t *testing.T) {
+	ErrUnauthorized := errors.New("unauthorized")
+	ErrForbidden := errors.New("forbidden")
+	statusErrors := map[int]error{
+		http.StatusUnauthorized: ErrUnauthorized,
+		http.StatusForbidden:    ErrForbidden,
+	}
+
+	t.Run("mapped status codes return their error", func(t *testing.T) {
+		err := MoqResponse(func(response *Response) {
+			response.StatusCode = http.StatusUnauthorized
+		}).Handle(WithResponseStatusErrors(statusErrors))
+		assert.True(t, errors.Is(err, ErrUnauthorized))
+
+		err = MoqResponse(func(response *Response) {
+			response.StatusCode = http.StatusForbidden
+		}).Handle(WithResponseStatusErrors(statusErrors))
+		assert.True(t, errors.Is(err, ErrForbidden))
+	})
+	t.Run("unmapped status code returns nil", func(t *testing.T) {
+		assert.NoError(t, MoqResponse().Handle(WithResponseStatusErrors(statusErrors)))
+	})
 }
 
 func TestWithResponseJSON(t *testing.T) {
@@ -60,6 +403,26 @@ func TestWithResponseJSON(t *testing.T) {
 		assert.Equal(t, "ok", resultOK.Status)
 	})
 
+	t.Run("204 without body is not deserialized", func(t *testing.T) {
+		resultOK := &testOK{}
+		err := MoqResponse(func(response *Response) {
+			response.StatusCode = http.StatusNoContent
+			response.Body = http.NoBody
+		}).Handle(WithResponseJSON(resultOK))
+
+		assert.NoError(t, err)
+		assert.Empty(t, resultOK.Status)
+	})
+
+	t.Run("empty body is not deserialized", func(t *testing.T) {
+		resultOK := &testOK{}
+		err := MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(strings.NewReader(""))
+		}).Handle(WithResponseJSON(resultOK), WithResponseXML(resultOK))
+
+		assert.NoError(t, err)
+	})
+
 	t.Run("body is JSON deserialized to nil", func(t *testing.T) {
 		var resultOK *testOK
 		err := MoqResponse(func(response *Response) {
@@ -71,6 +434,186 @@ func TestWithResponseJSON(t *testing.T) {
 
 		assert.Error(t, err)
 	})
+
+	t.Run("decode error contains content type and body snippet", func(t *testing.T) {
+		response := MoqResponse(func(response *Response) {
+			response.Header = http.Header{"Content-Type": {"text/html"}}
+			response.Body = io.NopCloser(strings.NewReader("<html>Bad Gateway</html>" + strings.Repeat("x", 500)))
+		})
+		err := response.Handle(WithResponseJSON(&testOK{}))
+
+		assert.ErrorContains(t, err, "Content-Type 'text/html'")
+		assert.ErrorContains(t, err, "<html>Bad Gateway</html>")
+		assert.NotContains(t, err.Error(), strings.Repeat("x", 200))
+
+		body, _ := io.ReadAll(response.Body)
+		assert.Len(t, body, 524)
+	})
+}
+
+func TestWithResponseJSONList(t *testing.T) {
+	t.Run("top-level array is deserialized to slice", func(t *testing.T) {
+		result := []struct{ Id int }{}
+		err := MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(strings.NewReader(`[{"id":1},{"id":2}]`))
+		}).Handle(WithResponseJSONList(&result))
+
+		assert.NoError(t, err)
+		assert.Len(t, result, 2)
+		assert.Equal(t, 1, result[0].Id)
+		assert.Equal(t, 2, result[1].Id)
+	})
+}
+
+func TestWithResponseJSONUseNumber(t *testing.T) {
+	t.Run("large integer is preserved as json.Number", func(t *testing.T) {
+		result := map[string]interface{}{}
+		err := MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(strings.NewReader(`{"id":9223372036854775807}`))
+		}).Handle(WithResponseJSONUseNumber(&result))
+
+		assert.NoError(t, err)
+		assert.Equal(t, json.Number("9223372036854775807"), result["id"])
+	})
+}
+
+// blockingBody returns a body which yields data and then blocks until it is closed.
+func blockingBody(data string) io.ReadCloser {
+	reader, writer := io.Pipe()
+	go writer.Write([]byte(data))
+	return reader
+}
+
+func TestWithResponseJSONContext(t *testing.T) {
+	t.Run("body is JSON deserialized to given object", func(t *testing.T) {
+		result := map[string]int{}
+		err := MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(strings.NewReader(`{"id":1}`))
+		}).Handle(WithResponseJSONContext(context.Background(), &result))
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, result["id"])
+	})
+	t.Run("cancelled context aborts a blocked decode", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*30)
+		defer cancel()
+
+		var err error
+		result := []int{}
+		elapsed := Elapsed(func() {
+			err = MoqResponse(func(response *Response) {
+				response.Body = blockingBody(`[1,2,3,`)
+			}).Handle(WithResponseJSONContext(ctx, &result))
+		})
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, elapsed, time.Millisecond*200)
+	})
+	t.Run("context done after a successful decode isn't an error", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		result := map[string]int{}
+		err := MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(readerFunc(func(p []byte) (int, error) {
+				defer cancel()
+				return copy(p, `{"id":1}`), nil
+			}))
+		}).Handle(WithResponseJSONContext(ctx, &result))
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, result["id"])
+	})
+}
+
+// readerFunc is an io.Reader which calls itself on every read.
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestWithResponseJSONToChannel(t *testing.T) {
+	type item struct {
+		ID int `json:"id"`
+	}
+
+	t.Run("array elements are sent to the channel", func(t *testing.T) {
+		ch := make(chan item)
+		done := make(chan error, 1)
+		go func() {
+			done <- MoqResponse(func(response *Response) {
+				response.Body = io.NopCloser(strings.NewReader(`[{"id":1},{"id":2},{"id":3}]`))
+			}).Handle(WithResponseJSONToChannel(context.Background(), ch))
+			close(ch)
+		}()
+
+		items := []item{}
+		for element := range ch {
+			items = append(items, element)
+		}
+
+		assert.NoError(t, <-done)
+		assert.Equal(t, []item{{1}, {2}, {3}}, items)
+	})
+	t.Run("non-array body fails", func(t *testing.T) {
+		err := MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(strings.NewReader(`{"id":1}`))
+		}).Handle(WithResponseJSONToChannel(context.Background(), make(chan item)))
+
+		assert.Error(t, err)
+	})
+	t.Run("cancelled context stops sending", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(strings.NewReader(`[{"id":1}]`))
+		}).Handle(WithResponseJSONToChannel(ctx, make(chan item)))
+
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+	t.Run("cancelled context aborts a blocked read", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*30)
+		defer cancel()
+
+		ch := make(chan item, 1)
+		var err error
+		elapsed := Elapsed(func() {
+			err = MoqResponse(func(response *Response) {
+				response.Body = blockingBody(`[{"id":1},`)
+			}).Handle(WithResponseJSONToChannel(ctx, ch))
+		})
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, elapsed, time.Millisecond*200)
+		assert.Equal(t, item{ID: 1}, <-ch)
+	})
+}
+
+func TestWithResponseRequireField(t *testing.T) {
+	type user struct {
+		Id   int    `json:"id"`
+		Name string `json:"name"`
+	}
+
+	moq := func(body string) *Response {
+		return MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(strings.NewReader(body))
+		})
+	}
+
+	t.Run("present field passes", func(t *testing.T) {
+		result := &user{}
+		err := moq(`{"id":1,"name":"github"}`).Handle(WithResponseRequireField(result, func(u *user) any { return u.Name }, "name"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "github", result.Name)
+	})
+	t.Run("missing field returns error", func(t *testing.T) {
+		err := moq(`{"id":1}`).Handle(WithResponseRequireField(&user{}, func(u *user) any { return u.Name }, "name"))
+		assert.EqualError(t, err, "required field 'name' is missing or empty")
+	})
 }
 
 func TestWithResponseXML(t *testing.T) {
@@ -94,3 +637,737 @@ func TestWithResponseXML(t *testing.T) {
 		assert.Equal(t, "github", resultOK.Name)
 	})
 }
+
+func TestWithResponseSOAPFault(t *testing.T) {
+	t.Run("fault in 200 response is returned as error", func(t *testing.T) {
+		fault := &SOAPFault{}
+		err := MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(strings.NewReader(`<?xml version="1.0"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+	<soap:Body>
+		<soap:Fault>
+			<faultcode>soap:Client</faultcode>
+			<faultstring>Invalid user id</faultstring>
+		</soap:Fault>
+	</soap:Body>
+</soap:Envelope>`))
+		}).Handle(WithResponseSOAPFault(fault))
+
+		var target *SOAPFault
+		assert.ErrorAs(t, err, &target)
+		assert.Equal(t, "soap:Client", fault.Code)
+		assert.Equal(t, "Invalid user id", fault.String)
+	})
+
+	t.Run("body without fault passes", func(t *testing.T) {
+		err := MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(strings.NewReader(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><ok/></soap:Body></soap:Envelope>`))
+		}).Handle(WithResponseSOAPFault(nil))
+
+		assert.NoError(t, err)
+	})
+}
+
+func TestWithResponseFormURLEncoded(t *testing.T) {
+	t.Run("body is parsed to the map", func(t *testing.T) {
+		result := map[string][]string{}
+		err := MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(strings.NewReader("a=1&a=2&b=3"))
+		}).Handle(WithResponseFormURLEncoded(&result))
+
+		assert.NoError(t, err)
+		assert.Equal(t, map[string][]string{"a": {"1", "2"}, "b": {"3"}}, result)
+	})
+	t.Run("malformed body fails", func(t *testing.T) {
+		err := MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(strings.NewReader("a=%zz"))
+		}).Handle(WithResponseFormURLEncoded(&map[string][]string{}))
+
+		assert.Error(t, err)
+	})
+}
+
+func TestWithResponseSaveOrError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("internal error"))
+			return
+		}
+
+		w.Write([]byte("file content"))
+	}))
+	defer server.Close()
+
+	t.Run("200 saves the body to the file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "download.txt")
+		err := New().GET(context.Background(), server.URL, "ok").Do().Handle(WithResponseSaveOrError(path))
+
+		assert.NoError(t, err)
+		content, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, "file content", string(content))
+	})
+	t.Run("500 returns the body as error without creating the file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "download.txt")
+		err := New().GET(context.Background(), server.URL, "fail").Do().Handle(WithResponseSaveOrError(path, http.StatusOK))
+
+		var statusError *StatusError
+		assert.ErrorAs(t, err, &statusError)
+		assert.Equal(t, http.StatusInternalServerError, statusError.Code)
+		assert.EqualError(t, err, "internal error")
+		assert.NoFileExists(t, path)
+	})
+}
+
+func TestWithResponseFile(t *testing.T) {
+	content := bytes.Repeat([]byte("requester "), 512)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	t.Run("body is streamed to the file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "download.bin")
+		assert.NoError(t, os.WriteFile(path, bytes.Repeat([]byte("stale"), 4096), 0o644))
+
+		err := New().GET(context.Background(), server.URL).Do().Handle(WithResponseFile(path, http.StatusOK))
+
+		assert.NoError(t, err)
+		written, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, content, written)
+	})
+	t.Run("file isn't written for other status codes", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "download.bin")
+		err := New().GET(context.Background(), server.URL).Do().Handle(WithResponseFile(path, http.StatusCreated))
+
+		assert.NoError(t, err)
+		assert.NoFileExists(t, path)
+	})
+	t.Run("filesystem error is returned", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "missing", "download.bin")
+		err := New().GET(context.Background(), server.URL).Do().Handle(WithResponseFile(path))
+
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func TestWithResponseSaveCookies(t *testing.T) {
+	t.Run("cookies are stored in the jar", func(t *testing.T) {
+		jar, _ := cookiejar.New(nil)
+		uri, _ := url.Parse(testURL)
+		err := MoqResponse(func(response *Response) {
+			response.Request = &http.Request{URL: uri}
+			response.Header = http.Header{"Set-Cookie": {"session=123", "theme=dark"}}
+		}).Handle(WithResponseSaveCookies(jar))
+
+		assert.NoError(t, err)
+		cookies := jar.Cookies(uri)
+		assert.Len(t, cookies, 2)
+		assert.Equal(t, "session", cookies[0].Name)
+		assert.Equal(t, "123", cookies[0].Value)
+	})
+	t.Run("missing request URL returns error", func(t *testing.T) {
+		jar, _ := cookiejar.New(nil)
+		assert.Error(t, MoqResponse().Handle(WithResponseSaveCookies(jar)))
+	})
+}
+
+func TestWithResponseProtobuf(t *testing.T) {
+	t.Run("body is passed to the message", func(t *testing.T) {
+		message := &fakeProtobuf{}
+		err := MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(bytes.NewReader([]byte{0x08, 0x96, 0x01}))
+		}).Handle(WithResponseProtobuf(message, http.StatusOK))
+
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0x08, 0x96, 0x01}, message.data)
+	})
+}
+
+func TestWithResponseInto(t *testing.T) {
+	type testOK struct {
+		XMLName xml.Name `json:"-" xml:"test"`
+		Name    string   `json:"name" xml:"name" yaml:"name"`
+	}
+
+	moq := func(contentType string, body []byte) *Response {
+		return MoqResponse(func(response *Response) {
+			response.Header = http.Header{"Content-Type": {contentType}}
+			response.Body = io.NopCloser(bytes.NewReader(body))
+		})
+	}
+
+	t.Run("JSON body is deserialized", func(t *testing.T) {
+		result := &testOK{}
+		err := moq("application/json", []byte(`{"name":"github"}`)).Handle(WithResponseInto(result))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "github", result.Name)
+	})
+	t.Run("XML body is deserialized", func(t *testing.T) {
+		result := &testOK{}
+		err := moq("text/xml; charset=utf-8", []byte(`<test><name>github</name></test>`)).Handle(WithResponseInto(result))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "github", result.Name)
+	})
+	t.Run("YAML body is deserialized", func(t *testing.T) {
+		result := &testOK{}
+		err := moq("application/yaml", []byte("name: github")).Handle(WithResponseInto(result))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "github", result.Name)
+	})
+	t.Run("Latin-1 JSON body is transcoded", func(t *testing.T) {
+		result := &testOK{}
+		err := moq("application/json; charset=ISO-8859-1", []byte("{\"name\":\"s\xf8k\"}")).Handle(WithResponseInto(result))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "søk", result.Name)
+	})
+	t.Run("unknown Content-Type returns error", func(t *testing.T) {
+		err := moq("text/plain", []byte("github")).Handle(WithResponseInto(&testOK{}))
+		assert.EqualError(t, err, "unable to decode response body (Content-Type 'text/plain', body 'github'): unsupported Content-Type 'text/plain'")
+	})
+}
+
+func TestWithResponseLines(t *testing.T) {
+	t.Run("each line is delivered", func(t *testing.T) {
+		lines := []string{}
+		err := MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(strings.NewReader("first\nsecond\nthird"))
+		}).Handle(WithResponseLines(func(line string) error {
+			lines = append(lines, line)
+			return nil
+		}))
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"first", "second", "third"}, lines)
+	})
+	t.Run("reading stops on callback error", func(t *testing.T) {
+		lines := []string{}
+		err := MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(strings.NewReader("first\nsecond\nthird"))
+		}).Handle(WithResponseLines(func(line string) error {
+			lines = append(lines, line)
+			return errors.New("stop")
+		}))
+
+		assert.EqualError(t, err, "stop")
+		assert.Equal(t, []string{"first"}, lines)
+	})
+	t.Run("line exceeding max size returns error", func(t *testing.T) {
+		err := MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(strings.NewReader("this line is too long"))
+		}).Handle(WithResponseLinesSize(8, func(line string) error { return nil }))
+
+		assert.ErrorIs(t, err, bufio.ErrTooLong)
+	})
+}
+
+func TestWithResponseCookieValue(t *testing.T) {
+	moq := func() *Response {
+		return MoqResponse(func(response *Response) {
+			response.Header = http.Header{"Set-Cookie": {"theme=dark", "session=123; HttpOnly", "lang=en"}}
+		})
+	}
+
+	t.Run("named cookie value is extracted", func(t *testing.T) {
+		value := ""
+		assert.NoError(t, moq().Handle(WithResponseCookieValue("session", &value)))
+		assert.Equal(t, "123", value)
+	})
+	t.Run("absent cookie yields empty value", func(t *testing.T) {
+		value := "stale"
+		assert.NoError(t, moq().Handle(WithResponseCookieValue("missing", &value)))
+		assert.Empty(t, value)
+	})
+}
+
+func TestWithResponseFinalURL(t *testing.T) {
+	t.Run("final URL after redirect is reported", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/old" {
+				http.Redirect(w, r, "/new", http.StatusFound)
+			}
+		}))
+		defer server.Close()
+
+		finalURL := url.URL{}
+		err := New().GET(context.Background(), server.URL, "old").Do().Handle(WithResponseFinalURL(&finalURL))
+
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("%s/new", server.URL), finalURL.String())
+	})
+	t.Run("missing request returns error", func(t *testing.T) {
+		assert.Error(t, MoqResponse().Handle(WithResponseFinalURL(&url.URL{})))
+	})
+}
+
+func TestWithResponseProxyTo(t *testing.T) {
+	moq := func() *Response {
+		return MoqResponse(func(response *Response) {
+			response.StatusCode = http.StatusCreated
+			response.Header = http.Header{"X-Test": {"1"}, "Connection": {"close"}}
+			response.Body = io.NopCloser(strings.NewReader("forwarded"))
+		})
+	}
+
+	t.Run("status, headers and body are forwarded", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		err := moq().Handle(WithResponseProxyTo(recorder, true))
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, recorder.Code)
+		assert.Equal(t, "1", recorder.Header().Get("X-Test"))
+		assert.Empty(t, recorder.Header().Get("Connection"))
+		assert.Equal(t, "forwarded", recorder.Body.String())
+	})
+	t.Run("headers are not forwarded", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		err := moq().Handle(WithResponseProxyTo(recorder, false))
+
+		assert.NoError(t, err)
+		assert.Empty(t, recorder.Header().Get("X-Test"))
+		assert.Equal(t, "forwarded", recorder.Body.String())
+	})
+}
+
+func TestWithResponseHexDump(t *testing.T) {
+	t.Run("body is dumped and survives", func(t *testing.T) {
+		dump := &bytes.Buffer{}
+		response := MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(bytes.NewReader([]byte{0x00, 0x01, 0x41, 0x42, 0xff}))
+		})
+
+		assert.NoError(t, response.Handle(WithResponseHexDump(dump, 4)))
+		assert.Equal(t, "00000000  00 01 41 42                                       |..AB|\n", dump.String())
+
+		body, err := io.ReadAll(response.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0x00, 0x01, 0x41, 0x42, 0xff}, body)
+	})
+}
+
+func TestWithResponseStreamKeepAlive(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 10; i++ {
+			w.Write([]byte("chunk\n"))
+			w.(http.Flusher).Flush()
+			if r.URL.Path == "/stall" && i == 1 {
+				time.Sleep(time.Millisecond * 300)
+			} else if r.URL.Path == "/slow" {
+				time.Sleep(time.Millisecond * 30)
+			}
+
+			time.Sleep(time.Millisecond * 10)
+		}
+	}))
+	defer server.Close()
+
+	t.Run("trickling stream completes", func(t *testing.T) {
+		lines := 0
+		err := New().GET(context.Background(), server.URL).Do().Handle(
+			WithResponseStreamKeepAlive(time.Millisecond*100),
+			WithResponseLines(func(line string) error {
+				lines++
+				return nil
+			}),
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 10, lines)
+	})
+	t.Run("stalled stream fails", func(t *testing.T) {
+		err := New().GET(context.Background(), server.URL, "stall").Do().Handle(
+			WithResponseStreamKeepAlive(time.Millisecond*100),
+			WithResponseLines(func(line string) error { return nil }),
+		)
+
+		assert.ErrorContains(t, err, "no bytes received within 100ms")
+	})
+	t.Run("request timeout doesn't interrupt a trickling stream", func(t *testing.T) {
+		lines := 0
+		err := New().GET(context.Background(), server.URL, "slow").Do(WithRequestTimeout(time.Millisecond*100)).Handle(
+			WithResponseStreamKeepAlive(time.Millisecond*100),
+			WithResponseLines(func(line string) error {
+				lines++
+				return nil
+			}),
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 10, lines)
+	})
+	t.Run("request timeout interrupts a trickling stream without keep-alive", func(t *testing.T) {
+		err := New().GET(context.Background(), server.URL, "slow").Do(WithRequestTimeout(time.Millisecond * 100)).Handle(
+			WithResponseLines(func(line string) error { return nil }),
+		)
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+	t.Run("context deadline still applies", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+		defer cancel()
+
+		err := New().GET(ctx, server.URL, "slow").Do(WithRequestTimeout(time.Second)).Handle(
+			WithResponseStreamKeepAlive(time.Millisecond*100),
+			WithResponseLines(func(line string) error { return nil }),
+		)
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestWithResponseJSONMergePatch(t *testing.T) {
+	type address struct {
+		City   string `json:"city,omitempty"`
+		Street string `json:"street,omitempty"`
+	}
+
+	type user struct {
+		Name    string  `json:"name,omitempty"`
+		Email   string  `json:"email,omitempty"`
+		Address address `json:"address"`
+	}
+
+	t.Run("patch nulls and updates fields", func(t *testing.T) {
+		target := &user{Name: "old", Email: "old@test.com", Address: address{City: "Oslo", Street: "Main"}}
+		err := MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(strings.NewReader(`{"name":"new","email":null,"address":{"street":null}}`))
+		}).Handle(WithResponseJSONMergePatch(target))
+
+		assert.NoError(t, err)
+		assert.Equal(t, &user{Name: "new", Address: address{City: "Oslo"}}, target)
+	})
+	t.Run("non-pointer target returns error", func(t *testing.T) {
+		err := MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(strings.NewReader(`{}`))
+		}).Handle(WithResponseJSONMergePatch(user{}))
+
+		assert.Error(t, err)
+	})
+}
+
+func TestWithResponseJSONSchema(t *testing.T) {
+	schema := []byte(`{
+		"type": "object",
+		"required": ["id", "name"],
+		"properties": {
+			"id": {"type": "integer"},
+			"name": {"type": "string"},
+			"tags": {"type": "array", "items": {"type": "string"}}
+		}
+	}`)
+
+	moq := func(body string) *Response {
+		return MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(strings.NewReader(body))
+		})
+	}
+
+	t.Run("valid body passes", func(t *testing.T) {
+		assert.NoError(t, moq(`{"id":1,"name":"github","tags":["a"]}`).Handle(WithResponseJSONSchema(schema)))
+	})
+	t.Run("missing required field fails", func(t *testing.T) {
+		err := moq(`{"id":1,"tags":[1]}`).Handle(WithResponseJSONSchema(schema))
+
+		assert.ErrorContains(t, err, "/: missing required property 'name'")
+		assert.ErrorContains(t, err, "/tags/0: expected type string, received integer")
+	})
+	t.Run("unsupported keywords fail", func(t *testing.T) {
+		schema := []byte(`{
+			"type": "object",
+			"additionalProperties": false,
+			"properties": {
+				"id": {"type": "integer", "minimum": 1},
+				"tags": {"type": "array", "items": {"$ref": "#/definitions/tag"}}
+			}
+		}`)
+		err := moq(`{"id":0}`).Handle(WithResponseJSONSchema(schema))
+
+		assert.ErrorContains(t, err, "/: unsupported JSON schema keyword 'additionalProperties'")
+		assert.ErrorContains(t, err, "/properties/id: unsupported JSON schema keyword 'minimum'")
+		assert.ErrorContains(t, err, "/properties/tags/items: unsupported JSON schema keyword '$ref'")
+	})
+	t.Run("pluggable validator is used", func(t *testing.T) {
+		validator := JSONSchemaValidatorFunc(func(schema, document []byte) error {
+			return errors.New("invalid")
+		})
+
+		assert.EqualError(t, moq(`{}`).Handle(WithResponseJSONSchemaValidator(validator, schema)), "response body doesn't match JSON schema: invalid")
+	})
+}
+
+func TestWithResponseSample(t *testing.T) {
+	t.Run("sample is written and full body decoded", func(t *testing.T) {
+		sample := &bytes.Buffer{}
+		result := map[string]string{}
+		err := MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(strings.NewReader(`{"name":"github"}`))
+		}).Handle(
+			WithResponseSample(sample, 5),
+			WithResponseJSON(&result),
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, `{"nam`, sample.String())
+		assert.Equal(t, "github", result["name"])
+	})
+}
+
+func TestWithResponseZlib(t *testing.T) {
+	t.Run("zlib-compressed JSON is decoded", func(t *testing.T) {
+		compressed := &bytes.Buffer{}
+		writer := zlib.NewWriter(compressed)
+		writer.Write([]byte(`{"name":"github"}`))
+		writer.Close()
+
+		result := map[string]string{}
+		err := MoqResponse(func(response *Response) {
+			response.Header = http.Header{"Content-Encoding": {"zlib"}}
+			response.Body = io.NopCloser(compressed)
+		}).Handle(WithResponseZlib(), WithResponseJSON(&result))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "github", result["name"])
+	})
+	t.Run("uncompressed body is left untouched", func(t *testing.T) {
+		result := map[string]string{}
+		err := MoqResponse(func(response *Response) {
+			response.Header = http.Header{}
+			response.Body = io.NopCloser(strings.NewReader(`{"name":"github"}`))
+		}).Handle(WithResponseZlib(), WithResponseJSON(&result))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "github", result["name"])
+	})
+}
+
+func TestWithResponseDecompress(t *testing.T) {
+	payload := []byte(`{"name":"github"}`)
+	compress := func(newWriter func(w io.Writer) io.WriteCloser) io.Reader {
+		buffer := &bytes.Buffer{}
+		writer := newWriter(buffer)
+		writer.Write(payload)
+		writer.Close()
+		return buffer
+	}
+	moq := func(encoding string, body io.Reader) *Response {
+		return MoqResponse(func(response *Response) {
+			response.Header = http.Header{}
+			if encoding != "" {
+				response.Header.Set("Content-Encoding", encoding)
+			}
+
+			response.Body = io.NopCloser(body)
+		})
+	}
+
+	t.Run("gzip-compressed JSON is decoded", func(t *testing.T) {
+		body := compress(func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })
+		result := map[string]string{}
+		err := moq("gzip", body).Handle(WithResponseDecompress(), WithResponseJSON(&result))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "github", result["name"])
+	})
+	t.Run("zlib-wrapped deflate JSON is decoded", func(t *testing.T) {
+		body := compress(func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) })
+		result := map[string]string{}
+		err := moq("deflate", body).Handle(WithResponseDecompress(), WithResponseJSON(&result))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "github", result["name"])
+	})
+	t.Run("raw deflate JSON is decoded", func(t *testing.T) {
+		body := compress(func(w io.Writer) io.WriteCloser {
+			writer, _ := flate.NewWriter(w, flate.DefaultCompression)
+			return writer
+		})
+		result := map[string]string{}
+		err := moq("deflate", body).Handle(WithResponseDecompress(), WithResponseJSON(&result))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "github", result["name"])
+	})
+	t.Run("identity and absent encodings are left untouched", func(t *testing.T) {
+		for _, encoding := range []string{"", "identity"} {
+			result := map[string]string{}
+			err := moq(encoding, bytes.NewReader(payload)).Handle(WithResponseDecompress(), WithResponseJSON(&result))
+
+			assert.NoError(t, err)
+			assert.Equal(t, "github", result["name"])
+		}
+	})
+	t.Run("unknown encoding fails", func(t *testing.T) {
+		err := moq("br", bytes.NewReader(payload)).Handle(WithResponseDecompress())
+		assert.EqualError(t, err, "unsupported Content-Encoding 'br'")
+	})
+	t.Run("response without headers is left untouched", func(t *testing.T) {
+		assert.NoError(t, (&Response{}).Handle(WithResponseDecompress(), WithResponseZlib()))
+	})
+	t.Run("gzip response to explicit Accept-Encoding is decoded", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", "gzip")
+			io.Copy(w, compress(func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }))
+		}))
+		defer server.Close()
+
+		result := map[string]string{}
+		err := New().GET(context.Background(), server.URL).
+			Do(WithRequestExpectGzip()).
+			Handle(WithResponseDecompress(), WithResponseJSON(&result))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "github", result["name"])
+	})
+}
+
+func TestWithResponseStripBOM(t *testing.T) {
+	moq := func() *Response {
+		return MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(strings.NewReader("\xef\xbb\xbf{\"name\":\"github\"}"))
+		})
+	}
+
+	t.Run("BOM-prefixed JSON fails without stripping", func(t *testing.T) {
+		assert.Error(t, moq().Handle(WithResponseJSON(&map[string]string{})))
+	})
+	t.Run("BOM-prefixed JSON is decoded after stripping", func(t *testing.T) {
+		result := map[string]string{}
+		err := moq().Handle(WithResponseStripBOM(), WithResponseJSON(&result))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "github", result["name"])
+	})
+}
+
+func TestWithResponseSlowThreshold(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(time.Millisecond * 50)
+		}
+	}))
+	defer server.Close()
+
+	t.Run("slow response triggers the callback", func(t *testing.T) {
+		var elapsed time.Duration
+		err := New().GET(context.Background(), server.URL, "slow").Do().Handle(
+			WithResponseSlowThreshold(time.Millisecond*20, func(d time.Duration) { elapsed = d }),
+		)
+
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, time.Millisecond*50, elapsed)
+	})
+	t.Run("fast response doesn't trigger the callback", func(t *testing.T) {
+		called := false
+		err := New().GET(context.Background(), server.URL).Do().Handle(
+			WithResponseSlowThreshold(time.Second, func(d time.Duration) { called = true }),
+		)
+
+		assert.NoError(t, err)
+		assert.False(t, called)
+	})
+}
+
+func TestWithResponseJSONEquals(t *testing.T) {
+	type expected struct {
+		Id   int      `json:"id"`
+		Name string   `json:"name"`
+		Tags []string `json:"tags"`
+	}
+
+	moq := func(body string) *Response {
+		return MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(strings.NewReader(body))
+		})
+	}
+
+	t.Run("equal payload with different key order passes", func(t *testing.T) {
+		err := moq(`{"tags":["a"],"name":"github","id":1}`).Handle(WithResponseJSONEquals(expected{Id: 1, Name: "github", Tags: []string{"a"}}))
+		assert.NoError(t, err)
+	})
+	t.Run("unequal payload lists the differences", func(t *testing.T) {
+		err := moq(`{"id":2,"tags":["a"],"extra":true}`).Handle(WithResponseJSONEquals(expected{Id: 1, Name: "github", Tags: []string{"a"}}))
+		assert.EqualError(t, err, "JSON body mismatch:\n/extra: unexpected true\n/id: expected 1, received 2\n/name: missing, expected \"github\"")
+	})
+}
+
+func TestWithResponseByteCount(t *testing.T) {
+	t.Run("bytes read by JSON decode are counted", func(t *testing.T) {
+		payload := `{"name":"github","tags":["a","b"]}`
+		count := int64(0)
+		result := map[string]any{}
+		err := MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(strings.NewReader(payload))
+		}).Handle(
+			WithResponseByteCount(&count),
+			WithResponseJSON(&result),
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(payload)), count)
+		assert.Equal(t, "github", result["name"])
+	})
+}
+
+func TestWithResponseProgress(t *testing.T) {
+	t.Run("progress is reported during a streamed read", func(t *testing.T) {
+		const size = 256 << 10
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", strconv.Itoa(size))
+			w.Write(make([]byte, size))
+		}))
+		defer server.Close()
+
+		reads := []int64{}
+		totals := []int64{}
+		response := New().GET(context.Background(), server.URL).Do()
+		err := response.Handle(
+			WithResponseProgress(func(read, total int64) {
+				reads = append(reads, read)
+				totals = append(totals, total)
+			}),
+			WithResponseBody(new([]byte), func(data []byte, v any) error { return nil }),
+		)
+
+		assert.NoError(t, err)
+		assert.Greater(t, len(reads), 1)
+		assert.Equal(t, int64(size), reads[len(reads)-1])
+		assert.IsIncreasing(t, reads)
+		assert.Equal(t, int64(size), totals[0])
+	})
+	t.Run("total is -1 when the length is unknown", func(t *testing.T) {
+		total := int64(0)
+		err := MoqResponse(func(response *Response) {
+			response.ContentLength = -1
+			response.Body = io.NopCloser(strings.NewReader("chunk"))
+		}).Handle(
+			WithResponseProgress(func(_, t int64) { total = t }),
+			WithResponseBody(new([]byte), func(data []byte, v any) error { return nil }),
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(-1), total)
+	})
+}
+
+func TestWithResponseReader(t *testing.T) {
+	t.Run("body is handed back to the caller", func(t *testing.T) {
+		var reader io.ReadCloser
+		response := MoqResponse(func(response *Response) {
+			response.Body = io.NopCloser(strings.NewReader("payload"))
+		})
+
+		assert.NoError(t, response.Handle(WithResponseReader(&reader)))
+		defer reader.Close()
+
+		body, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, "payload", string(body))
+		assert.Equal(t, http.NoBody, response.Body)
+	})
+}
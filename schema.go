@@ -0,0 +1,191 @@
+package requester
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// JSONSchemaValidator validates a JSON document against a JSON schema.
+type JSONSchemaValidator interface {
+	Validate(schema, document []byte) error
+}
+
+// JSONSchemaValidatorFunc is an adapter to allow the use of ordinary functions as JSONSchemaValidator.
+type JSONSchemaValidatorFunc func(schema, document []byte) error
+
+// Validate calls fn(schema, document).
+func (fn JSONSchemaValidatorFunc) Validate(schema, document []byte) error {
+	return fn(schema, document)
+}
+
+// basicSchemaValidator supports the type, enum, required, properties and items
+// keywords of JSON schema. Schemas with other keywords are rejected, so a schema is
+// never validated partially.
+type basicSchemaValidator struct{}
+
+// schemaKeywords are the keywords accepted by basicSchemaValidator. Annotations don't
+// affect validation and are accepted as well.
+var schemaKeywords = map[string]bool{
+	"type":        true,
+	"enum":        true,
+	"required":    true,
+	"properties":  true,
+	"items":       true,
+	"$schema":     true,
+	"$id":         true,
+	"$comment":    true,
+	"title":       true,
+	"description": true,
+	"default":     true,
+	"examples":    true,
+}
+
+func (basicSchemaValidator) Validate(schema, document []byte) error {
+	var s, d any
+	if err := json.Unmarshal(schema, &s); err != nil {
+		return fmt.Errorf("invalid JSON schema: %w", err)
+	}
+
+	if errs := unsupportedKeywords(s, ""); len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	if err := json.Unmarshal(document, &d); err != nil {
+		return fmt.Errorf("invalid JSON document: %w", err)
+	}
+
+	return errors.Join(validateSchema(s, d, "")...)
+}
+
+func validateSchema(schema, document any, path string) (errs []error) {
+	s, ok := schema.(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	location := path
+	if location == "" {
+		location = "/"
+	}
+
+	if expected, ok := s["type"]; ok {
+		types, ok := expected.([]any)
+		if !ok {
+			types = []any{expected}
+		}
+
+		actual := schemaType(document)
+		matched := false
+		for _, t := range types {
+			matched = matched || t == actual || (t == "number" && actual == "integer")
+		}
+
+		if !matched {
+			return append(errs, fmt.Errorf("%s: expected type %v, received %s", location, expected, actual))
+		}
+	}
+
+	if enum, ok := s["enum"].([]any); ok {
+		matched := false
+		for _, value := range enum {
+			matched = matched || reflect.DeepEqual(value, document)
+		}
+
+		if !matched {
+			errs = append(errs, fmt.Errorf("%s: value %v is not one of %v", location, document, enum))
+		}
+	}
+
+	if object, ok := document.(map[string]any); ok {
+		required, _ := s["required"].([]any)
+		for _, key := range required {
+			if _, ok := object[fmt.Sprint(key)]; !ok {
+				errs = append(errs, fmt.Errorf("%s: missing required property '%v'", location, key))
+			}
+		}
+
+		properties, _ := s["properties"].(map[string]any)
+		keys := make([]string, 0, len(properties))
+		for key := range properties {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			if value, ok := object[key]; ok {
+				errs = append(errs, validateSchema(properties[key], value, path+"/"+key)...)
+			}
+		}
+	}
+
+	if array, ok := document.([]any); ok {
+		for i, value := range array {
+			errs = append(errs, validateSchema(s["items"], value, fmt.Sprintf("%s/%d", path, i))...)
+		}
+	}
+
+	return errs
+}
+
+// unsupportedKeywords returns an error for each keyword of the schema and its subschemas which isn't
+// supported by basicSchemaValidator.
+func unsupportedKeywords(schema any, path string) (errs []error) {
+	s, ok := schema.(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	location := path
+	if location == "" {
+		location = "/"
+	}
+
+	keys := make([]string, 0, len(s))
+	for key := range s {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !schemaKeywords[key] {
+			errs = append(errs, fmt.Errorf("%s: unsupported JSON schema keyword '%s'", location, key))
+		}
+	}
+
+	properties, _ := s["properties"].(map[string]any)
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		errs = append(errs, unsupportedKeywords(properties[name], path+"/properties/"+name)...)
+	}
+
+	return append(errs, unsupportedKeywords(s["items"], path+"/items")...)
+}
+
+func schemaType(document any) string {
+	switch v := document.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
@@ -0,0 +1,71 @@
+package requester
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// timeoutContext is done when its parent is done or the timeout passes, like a context created by
+// context.WithTimeout. Unlike a context deadline, the timeout can be lifted, so a healthy stream
+// isn't interrupted by the timeout of the request.
+type timeoutContext struct {
+	context.Context
+	done     chan struct{}
+	once     sync.Once
+	mu       sync.Mutex
+	err      error
+	deadline time.Time
+	lifted   atomic.Bool
+	timer    *time.Timer
+	stop     func() bool
+}
+
+// withTimeout returns a copy of parent which is done when the timeout passes, unless it is lifted.
+func withTimeout(parent context.Context, timeout time.Duration) (*timeoutContext, context.CancelFunc) {
+	ctx := &timeoutContext{Context: parent, done: make(chan struct{}), deadline: time.Now().Add(timeout)}
+	ctx.timer = time.AfterFunc(timeout, func() { ctx.cancel(context.DeadlineExceeded) })
+	ctx.stop = context.AfterFunc(parent, func() { ctx.cancel(parent.Err()) })
+	return ctx, func() {
+		ctx.cancel(context.Canceled)
+		ctx.timer.Stop()
+		ctx.stop()
+	}
+}
+
+func (c *timeoutContext) Deadline() (time.Time, bool) {
+	deadline, ok := c.Context.Deadline()
+	if c.lifted.Load() || (ok && deadline.Before(c.deadline)) {
+		return deadline, ok
+	}
+
+	return c.deadline, true
+}
+
+func (c *timeoutContext) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *timeoutContext) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// lift stops the timeout. The context is still done when its parent is done or it is cancelled.
+func (c *timeoutContext) lift() {
+	if c.timer.Stop() {
+		c.lifted.Store(true)
+	}
+}
+
+func (c *timeoutContext) cancel(err error) {
+	c.once.Do(func() {
+		c.mu.Lock()
+		c.err = err
+		c.mu.Unlock()
+
+		close(c.done)
+	})
+}